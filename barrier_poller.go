@@ -0,0 +1,54 @@
+package ringo
+
+// barrierPoller lets a caller that owns its loop drive a consumeBarrier in place of its Run loop. Each
+// Poll hands the events the barrier can now pass to h and then moves the barrier past them, so h sees
+// each event once every dependency, or the quorum, has finished it, before any stage behind the
+// barrier does. The barrier is wired into the topology as usual, but is not Run.
+type barrierPoller struct {
+	barrier   *consumeBarrier // Tracks the events passed.
+	publisher sequencer       // The publisher, used to tell gating from idle.
+	values    []int64         // Scratch space for a quorum barrier.
+}
+
+// NewBarrierPoller is a factory function for returning a new instance of a barrierPoller.
+// p is the publisher of the ring. It lets Poll report PollGating instead of PollIdle while events
+// are waiting on the dependencies, and keeps a barrier with none from passing events not yet published.
+func NewBarrierPoller(b *consumeBarrier, p sequencer) *barrierPoller {
+	return &barrierPoller{
+		barrier:   b,
+		publisher: p,
+	}
+}
+
+// Poll hands every event the barrier can pass to h and moves the barrier past them. It never waits.
+// If h returns an error, it is returned with the barrier moved past every event before the failed
+// one, and the failed event is handed over again by the next Poll.
+func (b *barrierPoller) Poll(h Handler) (PollState, error) {
+	published := b.publisher.Sequence()
+	from, to := b.barrier.pollBatch(&b.values)
+	if to > published {
+		to = published
+	}
+	if to <= from {
+		if published > from {
+			return PollGating, nil
+		}
+		return PollIdle, nil
+	}
+	return PollProcessing, poll(h, from, to, b.commit)
+}
+
+// commit moves the barrier past the events processed, from up to but not including to.
+func (b *barrierPoller) commit(from int64, to int64) {
+	b.barrier.committed = to
+}
+
+// Barrier returns the barrier this poller drives.
+func (b *barrierPoller) Barrier() *consumeBarrier {
+	return b.barrier
+}
+
+// Sequence returns the index of the next event to be passed.
+func (b *barrierPoller) Sequence() int64 {
+	return b.barrier.Sequence()
+}
@@ -0,0 +1,156 @@
+package ringo
+
+import (
+	"runtime"
+	"testing"
+)
+
+// The disruptor example with a Type 1 publisher and Type 2 consumers:
+// 1 MultiPublishNode => StatusBridge => 2 SimpleNode => NodeBarrier => 1 SimpleNode => CounterBridge
+func TestBridgeType1ToType2(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := make([]int64, 32)
+
+	// Build the components
+	publisher := NewMultiPublishNode(32)
+	published := NewStatusBridge(32)
+	consumer1 := NewSimpleNode(false, 32)
+	consumer2 := NewSimpleNode(false, 32)
+	barrier := NewNodeBarrier(32)
+	consumer3 := NewSimpleNode(false, 32)
+	consumed := NewCounterBridge(32)
+
+	// Link the dependencies together, through the bridges where the types change.
+	published.SetDependency(publisher.Committed())
+	consumer1.SetDependency(published.Committed())
+	consumer2.SetDependency(published.Committed())
+	barrier.AddDependency(consumer1.Committed())
+	barrier.AddDependency(consumer2.Committed())
+	consumer3.SetDependency(barrier.Committed())
+	consumed.SetDependency(consumer3.Committed())
+	publisher.SetDependency(consumed.Committed())
+
+	done := make(chan bool)
+
+	for _, consumer := range []*simpleNode{consumer1, consumer2} {
+		go func(consumer *simpleNode) {
+			for i := int64(0); i < 1000; i++ {
+				ndx := consumer.Reserve()
+				if ring[ndx&31] != ndx {
+					t.Errorf("Expected %d, got %d", ndx, ring[ndx&31])
+				}
+				consumer.Commit(ndx)
+			}
+		}(consumer)
+	}
+
+	go func() {
+		for i := int64(0); i < 1000; i++ {
+			ndx := consumer3.Reserve()
+			if ndx != i || ring[ndx&31] != ndx {
+				t.Errorf("Expected %d at %d, got %d at %d", i, i, ring[ndx&31], ndx)
+			}
+			consumer3.Commit(ndx)
+		}
+		done <- true
+	}()
+
+	go published.Run()
+	go barrier.Run()
+	go consumed.Run()
+
+	for i := int64(0); i < 1000; i++ {
+		ndx := publisher.Reserve()
+		ring[ndx&31] = ndx
+		publisher.Commit()
+	}
+
+	<-done
+	for consumed.Sequence() < 1000 {
+		runtime.Gosched()
+	}
+	published.Stop()
+	barrier.Stop()
+	consumed.Stop()
+	if published.Sequence() != 1000 {
+		t.Errorf("Expected the status bridge at 1000, got %d", published.Sequence())
+	}
+}
+
+// The disruptor example with a Type 2 publisher and Type 1 consumers:
+// 1 SimpleNode => CounterBridge => 2 SimpleConsumeNode => Barrier => 1 SimpleConsumeNode => StatusBridge
+func TestBridgeType2ToType1(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := make([]int64, 32)
+
+	// Build the components
+	publisher := NewSimpleNode(true, 32)
+	published := NewCounterBridge(32)
+	consumer1 := NewSimpleConsumeNode()
+	consumer2 := NewSimpleConsumeNode()
+	barrier := NewConsumeBarrier()
+	consumer3 := NewSimpleConsumeNode()
+	consumed := NewStatusBridge(32)
+
+	// Link the dependencies together, through the bridges where the types change.
+	published.SetDependency(publisher.Committed())
+	consumer1.SetDependency(published.Committed())
+	consumer2.SetDependency(published.Committed())
+	barrier.AddDependency(consumer1.Committed())
+	barrier.AddDependency(consumer2.Committed())
+	consumer3.SetDependency(barrier.Committed())
+	consumed.SetDependency(consumer3.Committed())
+	publisher.SetDependency(consumed.Committed())
+
+	done := make(chan bool)
+
+	for _, consumer := range []*simpleConsumeNode{consumer1, consumer2} {
+		go func(consumer *simpleConsumeNode) {
+			for i := int64(0); i < 1000; i++ {
+				ndx := *consumer.Reserve()
+				if ring[ndx&31] != ndx {
+					t.Errorf("Expected %d, got %d", ndx, ring[ndx&31])
+				}
+				consumer.Commit()
+			}
+		}(consumer)
+	}
+
+	go func() {
+		for i := int64(0); i < 1000; i++ {
+			ndx := *consumer3.Reserve()
+			if ndx != i || ring[ndx&31] != ndx {
+				t.Errorf("Expected %d at %d, got %d at %d", i, i, ring[ndx&31], ndx)
+			}
+			consumer3.Commit()
+		}
+		done <- true
+	}()
+
+	go published.Run()
+	go barrier.Run()
+	go consumed.Run()
+
+	for i := int64(0); i < 1000; i++ {
+		ndx := publisher.Reserve()
+		ring[ndx&31] = ndx
+		publisher.Commit(ndx)
+	}
+
+	<-done
+	for consumed.Sequence() < 1000 {
+		runtime.Gosched()
+	}
+	published.Stop()
+	barrier.Stop()
+	consumed.Stop()
+	if published.Sequence() != 1000 {
+		t.Errorf("Expected the counter bridge at 1000, got %d", published.Sequence())
+	}
+}
@@ -0,0 +1,169 @@
+package ringo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// broadcastWriting marks a cell the publisher is in the middle of overwriting.
+const broadcastWriting int32 = math.MinInt32
+
+// ErrOverrun is matched by every OverrunError, for use with errors.Is.
+var ErrOverrun = errors.New("ringo: consumer overrun by publisher")
+
+// OverrunError is returned by a broadcastReader that has been lapped by its publisher.
+type OverrunError struct {
+	Missed int64 // Number of events overwritten before they could be read.
+}
+
+// Error returns a description of the overrun.
+func (e *OverrunError) Error() string {
+	return fmt.Sprintf("%s: %d events missed", ErrOverrun, e.Missed)
+}
+
+// Is reports whether target is ErrOverrun.
+func (e *OverrunError) Is(target error) bool {
+	return target == ErrOverrun
+}
+
+// broadcastNode is a lossy publisher for fanning events out to broadcastReaders.
+// It never waits for its readers. Instead it overwrites the oldest cell and stamps it with the
+// rotation it belongs to, in the same way as simpleNode. Readers compare the stamp with the rotation
+// they expect to find out if they have been lapped. Reserve and Commit can only be called by a
+// single go routine.
+type broadcastNode struct {
+	cachepad1 [8]int64 // Cacheline padding.
+	cursor    int64    // Tracks the cell id being processed in the ring.
+	cachepad2 [7]int64 // Cacheline padding.
+	committed []int32  // Tracks this nodes progress.
+	mask      int64    // Used in place of modulo for index calculations.
+	shift     uint8    // Used to mark a cell with which rotation processed.
+}
+
+// NewBroadcastNode is a factory function that returns a single broadcastNode instance.
+func NewBroadcastNode(size int64) *broadcastNode {
+	b := &broadcastNode{
+		cursor:    int64(initSeqValue),
+		committed: make([]int32, size),
+		mask:      size - 1,
+		shift:     uint8(math.Log2(float64(size))),
+	}
+
+	for i := int64(0); i < size; i++ {
+		b.committed[i] = int32(initSeqValue)
+	}
+	return b
+}
+
+// Reserve allocates the next cell in the ring for writing without waiting for any reader.
+// The cell is marked as being written so a reader still looking at its old contents can tell.
+func (b *broadcastNode) Reserve() int64 {
+	index := b.cursor + 1
+	atomic.StoreInt64(&b.cursor, index)
+	atomic.StoreInt32(&b.committed[index&b.mask], broadcastWriting)
+	return index
+}
+
+// Commit marks a cell in the ring status as completed and visible to the readers.
+func (b *broadcastNode) Commit(index int64) {
+	atomic.StoreInt32(&b.committed[index&b.mask], int32(index>>b.shift))
+}
+
+// Committed is a getter for the commit ring of this node.
+func (b *broadcastNode) Committed() []int32 {
+	return b.committed
+}
+
+// Sequence returns the index of the next cell to be committed.
+func (b *broadcastNode) Sequence() int64 {
+	cursor := atomic.LoadInt64(&b.cursor)
+	if atomic.LoadInt32(&b.committed[cursor&b.mask]) != int32(cursor>>b.shift) {
+		return cursor
+	}
+	return cursor + 1
+}
+
+// SetSequence positions the node so the next cell reserved is at seq, and stamps its commit ring as
+// if every cell below seq had been committed. It must be called before the node is in use.
+func (b *broadcastNode) SetSequence(seq int64) {
+	b.cursor = seq - 1
+	stampRing(b.committed, seq, b.shift)
+}
+
+// broadcastReader consumes events from a broadcastNode and detects when it has been lapped.
+// Each go routine reading from the broadcast should have its own broadcastReader.
+type broadcastReader struct {
+	cachepad1 [8]int64       // Cacheline padding.
+	cursor    int64          // Tracks the cell id being processed in the ring.
+	cachepad2 [7]int64       // Cacheline padding.
+	publisher *broadcastNode // The node whose events are read.
+}
+
+// NewBroadcastReader is a factory function that returns a single broadcastReader instance.
+func NewBroadcastReader() *broadcastReader {
+	return &broadcastReader{
+		cursor: int64(initSeqValue),
+	}
+}
+
+// Reserve waits for the next cell to be published and returns its index.
+// If the publisher has already overwritten the cell, an *OverrunError is returned with the number of
+// events missed and the reader is moved forward to the oldest event still in the ring.
+func (r *broadcastReader) Reserve() (int64, error) {
+	index := r.cursor + 1
+	lap := int32(index >> r.publisher.shift)
+	for atomic.LoadInt32(&r.publisher.committed[index&r.publisher.mask]) != lap {
+		if err := r.overrun(index); err != nil {
+			return index, err
+		}
+		time.Sleep(time.Microsecond)
+	}
+	r.cursor = index
+	return index, nil
+}
+
+// Commit confirms the cell at index was not overwritten while it was being read.
+// If it was, the data read must be discarded and an *OverrunError is returned as in Reserve.
+func (r *broadcastReader) Commit(index int64) error {
+	if atomic.LoadInt32(&r.publisher.committed[index&r.publisher.mask]) == int32(index>>r.publisher.shift) {
+		return nil
+	}
+	return r.overrun(index)
+}
+
+// Resync abandons any unread events and moves the reader to the newest event. It returns the index
+// that the next Reserve will read.
+func (r *broadcastReader) Resync() int64 {
+	r.cursor = atomic.LoadInt64(&r.publisher.cursor) - 1
+	return r.cursor + 1
+}
+
+// Sequence returns the index of the next cell to be read.
+func (r *broadcastReader) Sequence() int64 {
+	return atomic.LoadInt64(&r.cursor) + 1
+}
+
+// SetSequence positions the reader so the next cell read is at seq.
+// It must be called before the reader is in use.
+func (r *broadcastReader) SetSequence(seq int64) {
+	r.cursor = seq - 1
+}
+
+// SetDependency is a setter for the publisher this reader follows.
+func (r *broadcastReader) SetDependency(p *broadcastNode) {
+	r.publisher = p
+}
+
+// overrun checks if the cell for index has been reused by a later rotation. If so, the reader is
+// moved to the oldest cell still available and the error describing the loss is returned.
+func (r *broadcastReader) overrun(index int64) error {
+	oldest := atomic.LoadInt64(&r.publisher.cursor) - r.publisher.mask
+	if oldest <= index {
+		return nil
+	}
+	r.cursor = oldest - 1
+	return &OverrunError{Missed: oldest - index}
+}
@@ -0,0 +1,92 @@
+package ringo
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// A lossy broadcast: Publisher ==> n Readers, where slow readers are overrun.
+func TestBroadcastOverrun(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := make([]int64, 16)
+	publisher := NewBroadcastNode(16)
+	readers := []*broadcastReader{NewBroadcastReader(), NewBroadcastReader()}
+
+	done := make(chan bool)
+	for i, r := range readers {
+		r.SetDependency(publisher)
+		go func(r *broadcastReader, slow bool) {
+			var read, missed int64
+			for read+missed < 4096 {
+				ndx, err := r.Reserve()
+				if err == nil {
+					v := ring[ndx&15]
+					if slow {
+						time.Sleep(10 * time.Microsecond)
+					}
+					err = r.Commit(ndx)
+					if err == nil && v != ndx {
+						t.Errorf("Expected %d, got %d.", ndx, v)
+					}
+				}
+				var overrun *OverrunError
+				switch {
+				case err == nil:
+					read++
+				case errors.As(err, &overrun):
+					missed += overrun.Missed
+				default:
+					t.Errorf("Unexpected error: %s", err)
+				}
+			}
+			if read+missed != 4096 {
+				t.Errorf("Expected 4096 events read or missed, got %d and %d.", read, missed)
+			}
+			done <- true
+		}(r, i == 1)
+	}
+
+	for i := int64(0); i < 4096; i++ {
+		ndx := publisher.Reserve()
+		ring[ndx&15] = ndx
+		publisher.Commit(ndx)
+		if i%64 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	<-done
+	<-done
+}
+
+func TestBroadcastResync(t *testing.T) {
+	publisher := NewBroadcastNode(8)
+	reader := NewBroadcastReader()
+	reader.SetDependency(publisher)
+
+	for i := 0; i < 20; i++ {
+		publisher.Commit(publisher.Reserve())
+	}
+
+	_, err := reader.Reserve()
+	if !errors.Is(err, ErrOverrun) {
+		t.Fatalf("Expected an overrun, got %v.", err)
+	}
+	if missed := err.(*OverrunError).Missed; missed != 12 {
+		t.Errorf("Expected 12 events missed, got %d.", missed)
+	}
+	if ndx, err := reader.Reserve(); ndx != 12 || err != nil {
+		t.Errorf("Expected to read the oldest event 12, got %d %v.", ndx, err)
+	}
+
+	if next := reader.Resync(); next != 19 {
+		t.Errorf("Expected resync to the newest event 19, got %d.", next)
+	}
+	if ndx, err := reader.Reserve(); ndx != 19 || err != nil {
+		t.Errorf("Expected to read 19, got %d %v.", ndx, err)
+	}
+}
@@ -0,0 +1,102 @@
+package ringo
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint is a consistent set of sequences captured across a topology.
+type Checkpoint struct {
+	Taken     time.Time        `json:"taken"`     // When the checkpoint was captured.
+	Sequences map[string]int64 `json:"sequences"` // Next index of each node, by name.
+}
+
+// Resume returns the lowest sequence in the checkpoint. Everything below it was processed by every
+// node, so after a restart every node is positioned here with SetSequence and the events from here
+// on are replayed from the journal.
+func (c *Checkpoint) Resume() int64 {
+	resume := sequenceMax
+	for _, seq := range c.Sequences {
+		if seq < resume {
+			resume = seq
+		}
+	}
+	if resume == sequenceMax {
+		return 0
+	}
+	return resume
+}
+
+// Save writes the checkpoint to path. The file is replaced atomically so a crash while saving
+// leaves the previous checkpoint in place.
+func (c *Checkpoint) Save(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// LoadCheckpoint reads a checkpoint written by Save.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// checkpointer captures the sequences of a running topology.
+// Nodes are added in topology order, publisher first. Capture reads them in reverse, so every node
+// is read before anything it depends on and no captured sequence is ahead of its upstream.
+type checkpointer struct {
+	names []string    // Names of the nodes, in topology order.
+	nodes []sequencer // The nodes to read.
+}
+
+// NewCheckpointer is a factory function for returning a new instance of a checkpointer.
+func NewCheckpointer() *checkpointer {
+	return &checkpointer{}
+}
+
+// Add registers a node, barrier or stage under name.
+func (c *checkpointer) Add(name string, s sequencer) {
+	c.names = append(c.names, name)
+	c.nodes = append(c.nodes, s)
+}
+
+// Capture reads the sequence of every node and returns them as a checkpoint.
+func (c *checkpointer) Capture() *Checkpoint {
+	cp := &Checkpoint{
+		Taken:     time.Now(),
+		Sequences: make(map[string]int64, len(c.nodes)),
+	}
+	for i := len(c.nodes) - 1; i >= 0; i-- {
+		cp.Sequences[c.names[i]] = c.nodes[i].Sequence()
+	}
+	return cp
+}
@@ -0,0 +1,284 @@
+package ringo
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// The disruptor example resumed from sequence 1000 and checkpointed once drained.
+func TestCheckpointType1(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	const start = 1000
+
+	// Build the components
+	publisher := NewSimplePublishNode(32)
+	consumer1 := NewSimpleConsumeNode()
+	consumer2 := NewSimpleConsumeNode()
+	barrier := NewConsumeBarrier()
+	consumer3 := NewSimpleConsumeNode()
+
+	// Link the committed counter dependencies together.
+	consumer1.SetDependency(publisher.Committed())
+	consumer2.SetDependency(publisher.Committed())
+	barrier.AddDependency(consumer1.Committed())
+	barrier.AddDependency(consumer2.Committed())
+	consumer3.SetDependency(barrier.Committed())
+	publisher.SetDependency(consumer3.Committed())
+
+	// Position everything at the start.
+	publisher.SetSequence(start)
+	consumer1.SetSequence(start)
+	consumer2.SetSequence(start)
+	barrier.SetSequence(start)
+	consumer3.SetSequence(start)
+
+	c := NewCheckpointer()
+	c.Add("publisher", publisher)
+	c.Add("consumer1", consumer1)
+	c.Add("consumer2", consumer2)
+	c.Add("barrier", barrier)
+	c.Add("consumer3", consumer3)
+
+	done := make(chan bool)
+
+	go func() {
+		for i := int64(0); i < 64; i++ {
+			consumer1.Reserve()
+			consumer1.Commit()
+		}
+	}()
+
+	go func() {
+		for i := int64(0); i < 64; i++ {
+			consumer2.Reserve()
+			consumer2.Commit()
+		}
+	}()
+
+	go func() {
+		barrier.Run()
+	}()
+
+	go func() {
+		for i := int64(0); i < 64; i++ {
+			ndx := *consumer3.Reserve()
+			if ndx != start+i {
+				t.Errorf("Expected index %d, got %d", start+i, ndx)
+			}
+			consumer3.Commit()
+		}
+		done <- true
+	}()
+
+	for i := int64(0); i < 64; i++ {
+		ndx := *publisher.Reserve()
+		if ndx != start+i {
+			t.Fatalf("Expected index %d, got %d", start+i, ndx)
+		}
+		publisher.Commit()
+	}
+
+	<-done
+	barrier.Stop()
+
+	cp := c.Capture()
+	for name, seq := range cp.Sequences {
+		if seq != start+64 {
+			t.Errorf("Expected %s at %d, got %d", name, start+64, seq)
+		}
+	}
+	if cp.Resume() != start+64 {
+		t.Errorf("Expected resume at %d, got %d", start+64, cp.Resume())
+	}
+}
+
+// The disruptor example resumed from sequence 77, partway through a rotation.
+func TestCheckpointType2(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	const start = 77
+
+	// Build the components
+	publisher := NewSimpleNode(true, 32)
+	consumer1 := NewSimpleNode(false, 32)
+	consumer2 := NewSimpleNode(false, 32)
+	barrier := NewNodeBarrier(32)
+	consumer3 := NewSimpleNode(false, 32)
+
+	// Link the committed counter dependencies together.
+	consumer1.SetDependency(publisher.Committed())
+	consumer2.SetDependency(publisher.Committed())
+	barrier.AddDependency(consumer1.Committed())
+	barrier.AddDependency(consumer2.Committed())
+	consumer3.SetDependency(barrier.Committed())
+	publisher.SetDependency(consumer3.Committed())
+
+	// Position everything at the start.
+	publisher.SetSequence(start)
+	consumer1.SetSequence(start)
+	consumer2.SetSequence(start)
+	barrier.SetSequence(start)
+	consumer3.SetSequence(start)
+
+	c := NewCheckpointer()
+	c.Add("publisher", publisher)
+	c.Add("consumer1", consumer1)
+	c.Add("consumer2", consumer2)
+	c.Add("barrier", barrier)
+	c.Add("consumer3", consumer3)
+
+	done := make(chan bool)
+
+	go func() {
+		for i := int64(0); i < 64; i++ {
+			ndx := consumer1.Reserve()
+			consumer1.Commit(ndx)
+		}
+	}()
+
+	go func() {
+		for i := int64(0); i < 64; i++ {
+			ndx := consumer2.Reserve()
+			consumer2.Commit(ndx)
+		}
+	}()
+
+	go func() {
+		barrier.Run()
+	}()
+
+	go func() {
+		for i := int64(0); i < 64; i++ {
+			ndx := consumer3.Reserve()
+			if ndx != start+i {
+				t.Errorf("Expected index %d, got %d", start+i, ndx)
+			}
+			consumer3.Commit(ndx)
+		}
+		done <- true
+	}()
+
+	// Publish two batches, checkpointing in between.
+	for i := int64(0); i < 32; i++ {
+		ndx := publisher.Reserve()
+		publisher.Commit(ndx)
+	}
+	cp := c.Capture()
+	if seq := cp.Sequences["publisher"]; seq != start+32 {
+		t.Errorf("Expected publisher at %d, got %d", start+32, seq)
+	}
+	if cp.Resume() < start || cp.Resume() > start+32 {
+		t.Errorf("Expected resume between %d and %d, got %d", start, start+32, cp.Resume())
+	}
+	if cp.Sequences["consumer3"] > cp.Sequences["barrier"] {
+		t.Errorf("Consumer 3 captured ahead of its barrier: %v", cp.Sequences)
+	}
+
+	for i := int64(32); i < 64; i++ {
+		ndx := publisher.Reserve()
+		publisher.Commit(ndx)
+	}
+
+	<-done
+	for barrier.Sequence() < start+64 {
+		runtime.Gosched()
+	}
+	barrier.Stop()
+
+	cp = c.Capture()
+	for name, seq := range cp.Sequences {
+		if seq != start+64 {
+			t.Errorf("Expected %s at %d, got %d", name, start+64, seq)
+		}
+	}
+}
+
+// A checkpoint survives a round trip through a file.
+// A checkpoint taken while a batch is part way through only counts the cells committed so far, so a
+// restart from it processes the rest of the batch again:
+// 1 SimpleNode => 1 SimpleNode(batch) => 1 NodePoller
+func TestCheckpointPartialBatch(t *testing.T) {
+	// Build the components
+	publisher := NewSimpleNode(true, 32)
+	consumer := NewSimpleNode(false, 32)
+	poller := NewNodePoller(NewSimpleNode(false, 32), publisher)
+
+	// Link the committed counter dependencies together.
+	consumer.SetDependency(publisher.Committed())
+	poller.Node().SetDependency(consumer.Committed())
+	publisher.SetDependency(poller.Node().Committed())
+
+	c := NewCheckpointer()
+	c.Add("publisher", publisher)
+	c.Add("consumer", consumer)
+	c.Add("poller", poller)
+
+	for i := 0; i < 6; i++ {
+		publisher.Commit(publisher.Reserve())
+	}
+
+	// The consumer reserves all six, then commits them in two parts.
+	from, to := consumer.ReserveBatch()
+	if from != 0 || to != 6 {
+		t.Fatalf("Expected to reserve 0 to 6, got %d to %d", from, to)
+	}
+	if seq := c.Capture().Sequences["consumer"]; seq != 0 {
+		t.Errorf("Expected nothing committed, got %d", seq)
+	}
+	consumer.CommitBatch(0, 3)
+	if seq := c.Capture().Sequences["consumer"]; seq != 3 {
+		t.Errorf("Expected 3 committed, got %d", seq)
+	}
+	consumer.CommitBatch(3, 6)
+
+	// The poller is checkpointed from inside its handler.
+	h := HandlerFunc(func(seq int64, endOfBatch bool) error {
+		if got := c.Capture().Sequences["poller"]; got != 0 {
+			t.Errorf("Expected the poller at 0 while handling %d, got %d", seq, got)
+		}
+		return nil
+	})
+	if state, err := poller.Poll(h); state != PollProcessing || err != nil {
+		t.Fatalf("Expected processing, got %d and %v", state, err)
+	}
+	if cp := c.Capture(); cp.Sequences["publisher"] != 6 || cp.Sequences["poller"] != 6 {
+		t.Errorf("Expected everything at 6, got %v", cp.Sequences)
+	}
+}
+
+func TestCheckpointSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	publisher := NewMultiNode(true, 32)
+	consumer := NewSimpleConsumeNode()
+	publisher.SetSequence(500)
+	consumer.SetSequence(480)
+
+	c := NewCheckpointer()
+	c.Add("publisher", publisher)
+	c.Add("consumer", consumer)
+	cp := c.Capture()
+	if err := cp.Save(path); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	loaded, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if loaded.Sequences["publisher"] != 500 || loaded.Sequences["consumer"] != 480 {
+		t.Errorf("Unexpected sequences: %v", loaded.Sequences)
+	}
+	if !loaded.Taken.Equal(cp.Taken) {
+		t.Errorf("Expected taken %s, got %s", cp.Taken, loaded.Taken)
+	}
+	if loaded.Resume() != 480 {
+		t.Errorf("Expected resume at 480, got %d", loaded.Resume())
+	}
+}
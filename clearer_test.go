@@ -0,0 +1,140 @@
+package ringo
+
+import (
+	"runtime"
+	"testing"
+)
+
+// payload is a heap allocated event referenced from a ring.
+type payload struct {
+	value int64
+}
+
+// A simple queue whose cells are cleared after use: Publisher => Consumer => Clearer
+func TestConsumeClearer(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := make([]*payload, 32)
+
+	// Build the components
+	publisher := NewSimplePublishNode(32)
+	consumer := NewSimpleConsumeNode()
+	clearer := NewConsumeClearer(ResetFunc(func(index int64) {
+		ring[index&31] = nil
+	}))
+
+	// Link the committed counter dependencies together.
+	consumer.SetDependency(publisher.Committed())
+	clearer.SetDependency(consumer.Committed())
+	publisher.SetDependency(clearer.Committed())
+
+	done := make(chan bool)
+
+	go func() {
+		clearer.Run()
+	}()
+
+	go func() {
+		for i := int64(0); i < 1000; i++ {
+			ndx := *consumer.Reserve()
+			if ring[ndx&31].value != i {
+				t.Errorf("Expected %d, got %d", i, ring[ndx&31].value)
+			}
+			consumer.Commit()
+		}
+		done <- true
+	}()
+
+	for i := int64(0); i < 1000; i++ {
+		ndx := *publisher.Reserve()
+		if ring[ndx&31] != nil {
+			t.Fatalf("Expected cell %d to have been cleared", ndx)
+		}
+		ring[ndx&31] = &payload{value: i}
+		publisher.Commit()
+	}
+
+	<-done
+	for clearer.Sequence() < 1000 {
+		runtime.Gosched()
+	}
+	clearer.Stop()
+	for i, p := range ring {
+		if p != nil {
+			t.Errorf("Expected cell %d to have been cleared", i)
+		}
+	}
+}
+
+// The disruptor example with a schema cleared after the last consumer:
+// 1 SimpleNode => 2 SimpleNode => Barrier => Clearer
+func TestNodeClearer(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	events := NewSchema(32)
+	value := events.Declare("value", ColumnInt64)
+
+	// Build the components
+	publisher := NewSimpleNode(true, 32)
+	consumer1 := NewSimpleNode(false, 32)
+	consumer2 := NewSimpleNode(false, 32)
+	barrier := NewNodeBarrier(32)
+	clearer := NewNodeClearer(32, events)
+
+	// Link the committed counter dependencies together.
+	consumer1.SetDependency(publisher.Committed())
+	consumer2.SetDependency(publisher.Committed())
+	barrier.AddDependency(consumer1.Committed())
+	barrier.AddDependency(consumer2.Committed())
+	clearer.SetDependency(barrier.Committed())
+	publisher.SetDependency(clearer.Committed())
+
+	done := make(chan bool)
+
+	for _, consumer := range []*simpleNode{consumer1, consumer2} {
+		go func(consumer *simpleNode) {
+			for i := int64(0); i < 1000; i++ {
+				ndx := consumer.Reserve()
+				if value.Int64(ndx) != i+1 {
+					t.Errorf("Expected %d, got %d", i+1, value.Int64(ndx))
+				}
+				consumer.Commit(ndx)
+			}
+			done <- true
+		}(consumer)
+	}
+
+	go func() {
+		barrier.Run()
+	}()
+
+	go func() {
+		clearer.Run()
+	}()
+
+	for i := int64(0); i < 1000; i++ {
+		ndx := publisher.Reserve()
+		if value.Int64(ndx) != 0 {
+			t.Fatalf("Expected cell %d to have been cleared", ndx)
+		}
+		value.SetInt64(ndx, i+1)
+		publisher.Commit(ndx)
+	}
+
+	<-done
+	<-done
+	for clearer.Sequence() < 1000 {
+		runtime.Gosched()
+	}
+	clearer.Stop()
+	barrier.Stop()
+	for i, v := range value.Int64s() {
+		if v != 0 {
+			t.Errorf("Expected cell %d to have been cleared", i)
+		}
+	}
+}
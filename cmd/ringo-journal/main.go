@@ -0,0 +1,218 @@
+// Command ringo-journal inspects and repairs journals written by a ringo journaler.
+//
+// Usage:
+//
+//	ringo-journal segments <dir>
+//	ringo-journal verify <dir>
+//	ringo-journal dump [-from seq] [-to seq] [-format hex|json] [-decoder name] <dir>
+//	ringo-journal tail [-from seq] [-format hex|json] [-decoder name] [-interval d] <dir>
+//	ringo-journal truncate -seq seq <dir>
+//
+// Records are printed one per line. Without a decoder, json lines carry the raw payload as hex.
+// Decoders are registered with ringo.RegisterJournalDecoder by packages imported into the command,
+// so to print your own events, build a copy of this command that imports the package defining them.
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	ringo "github.com/composer22/ringo-mundo"
+)
+
+// errDone ends a dump once the last sequence asked for has been printed.
+var errDone = errors.New("done")
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "segments":
+		err = segments(args)
+	case "verify":
+		err = verify(args)
+	case "dump":
+		err = dump(args, false)
+	case "tail":
+		err = dump(args, true)
+	case "truncate":
+		err = truncate(args)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ringo-journal: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// usage prints the command summary and exits.
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ringo-journal segments|verify|dump|tail|truncate [flags] <dir>")
+	if names := ringo.JournalDecoders(); len(names) > 0 {
+		fmt.Fprintf(os.Stderr, "decoders: %s\n", strings.Join(names, ", "))
+	}
+	os.Exit(2)
+}
+
+// parse parses the flags of a command and returns the journal directory.
+func parse(fs *flag.FlagSet, args []string) string {
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: ringo-journal %s [flags] <dir>\n", fs.Name())
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+	return fs.Arg(0)
+}
+
+// segments lists the segment files of a journal.
+func segments(args []string) error {
+	dir := parse(flag.NewFlagSet("segments", flag.ExitOnError), args)
+	list, err := ringo.JournalSegments(dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range list {
+		fmt.Printf("%d\t%d\t%s\n", s.First, s.Size, s.Path)
+	}
+	return nil
+}
+
+// verify checks the checksums and sequence continuity of a journal.
+func verify(args []string) error {
+	dir := parse(flag.NewFlagSet("verify", flag.ExitOnError), args)
+	list, err := ringo.JournalSegments(dir)
+	if err != nil {
+		return err
+	}
+	next, err := ringo.VerifyJournal(dir)
+	if err != nil {
+		return err
+	}
+	first := next
+	if len(list) > 0 {
+		first = list[0].First
+	}
+	fmt.Printf("ok: %d segments, sequences %d to %d\n", len(list), first, next-1)
+	return nil
+}
+
+// dump prints the records of a journal, and if follow is set keeps polling for new ones.
+func dump(args []string, follow bool) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	if follow {
+		fs = flag.NewFlagSet("tail", flag.ExitOnError)
+	}
+	from := fs.Int64("from", -1, "first sequence to print (default: start, or end when tailing)")
+	to := fs.Int64("to", -1, "last sequence to print (default: end)")
+	format := fs.String("format", "json", "output format: hex or json")
+	decoder := fs.String("decoder", "", "registered decoder for json output")
+	interval := fs.Duration("interval", 100*time.Millisecond, "how often to poll when tailing")
+	dir := parse(fs, args)
+
+	p, err := newPrinter(os.Stdout, *format, *decoder)
+	if err != nil {
+		return err
+	}
+	emit := func(seq int64, data []byte) error {
+		if *to >= 0 && seq > *to {
+			return errDone
+		}
+		return p.print(seq, data)
+	}
+
+	next := *from
+	if next < 0 {
+		next = 0
+		if follow {
+			if next, err = ringo.ReadJournal(dir, 0, func(int64, []byte) error { return nil }); err != nil {
+				return err
+			}
+		}
+	}
+	for {
+		next, err = ringo.ReadJournal(dir, next, emit)
+		if ferr := p.w.Flush(); err == nil {
+			err = ferr
+		}
+		if err == errDone {
+			return nil
+		}
+		if err != nil || !follow {
+			return err
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// truncate removes every record at or after a sequence.
+func truncate(args []string) error {
+	fs := flag.NewFlagSet("truncate", flag.ExitOnError)
+	seq := fs.Int64("seq", -1, "first sequence to remove")
+	dir := parse(fs, args)
+	if *seq < 0 {
+		return errors.New("truncate: -seq is required")
+	}
+	return ringo.TruncateJournal(dir, *seq)
+}
+
+// printer writes records in one of the output formats.
+type printer struct {
+	w       *bufio.Writer
+	json    *json.Encoder
+	decoder ringo.JournalDecoder
+}
+
+// newPrinter returns a printer for format, decoding json records with the named decoder if given.
+func newPrinter(w io.Writer, format string, decoder string) (*printer, error) {
+	p := &printer{w: bufio.NewWriter(w)}
+	switch format {
+	case "hex":
+	case "json":
+		p.json = json.NewEncoder(p.w)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	if decoder != "" {
+		d, ok := ringo.LookupJournalDecoder(decoder)
+		if !ok {
+			return nil, fmt.Errorf("unknown decoder %q", decoder)
+		}
+		p.decoder = d
+	}
+	return p, nil
+}
+
+// print writes one record.
+func (p *printer) print(seq int64, data []byte) error {
+	if p.json == nil {
+		_, err := fmt.Fprintf(p.w, "%d\t%s\n", seq, hex.EncodeToString(data))
+		return err
+	}
+	if p.decoder == nil {
+		return p.json.Encode(struct {
+			Seq  int64  `json:"seq"`
+			Size int    `json:"size"`
+			Data string `json:"data"`
+		}{seq, len(data), hex.EncodeToString(data)})
+	}
+	event, err := p.decoder(seq, data)
+	if err != nil {
+		return fmt.Errorf("sequence %d: %s", seq, err)
+	}
+	return p.json.Encode(struct {
+		Seq   int64       `json:"seq"`
+		Event interface{} `json:"event"`
+	}{seq, event})
+}
@@ -1,6 +1,9 @@
 package ringo
 
-import "runtime"
+import (
+	"runtime"
+	"sync/atomic"
+)
 
 // consumeBarrier acts as a collector of committed states, setting itself to reflect the lowest found.
 // This is used to setup dependencies between multiple components.
@@ -8,37 +11,84 @@ import "runtime"
 // to complete their work on a cell in a ring buffer. A Barrier would watch the first two Consumers
 // and record the lowest completed result. The third Consumer would check the barrier to see if it
 // can proceed to read the next cell.
+// A quorum barrier instead records the highest result reached by at least quorum of the dependencies,
+// such as any one of several replicas. Barriers of either kind can depend on each other.
+// A quorum barrier is only for downstream stages. The publisher must stay gated on every replica,
+// directly or through an all-of barrier, or it laps the slowest one and overwrites cells it has yet
+// to read.
 type consumeBarrier struct {
 	cachepad1    [8]int64
 	committed    int64 // Lowest committed cell value from the dependencies.
 	cachepad2    [7]int64
-	dependencies []*int64 // A list of committed registers for upstream activity.
-	running      bool     // Is this Barrier chasing the dependencies in a Run() loop?
+	dependencies gatingSet // A list of committed registers for upstream activity.
+	quorum       int       // How many dependencies must reach a cell. Zero means all of them.
+	running      bool      // Is this Barrier chasing the dependencies in a Run() loop?
 }
 
 // Factory function for returning a new instance of a consumeBarrier.
 func NewConsumeBarrier() *consumeBarrier {
+	return &consumeBarrier{}
+}
+
+// NewQuorumBarrier is a factory function for returning a new instance of a consumeBarrier that
+// passes a cell once quorum of its dependencies have committed it.
+func NewQuorumBarrier(quorum int) *consumeBarrier {
 	return &consumeBarrier{
-		dependencies: make([]*int64, 0),
+		quorum: quorum,
 	}
 }
 
+// NewAnyOfBarrier is a factory function for returning a new instance of a consumeBarrier that
+// passes a cell once any one of its dependencies has committed it.
+func NewAnyOfBarrier() *consumeBarrier {
+	return NewQuorumBarrier(1)
+}
+
 // Run continually updates the current count by chasing the multiple dependencies.
 func (b *consumeBarrier) Run() {
-	var lowest int64
+	var values []int64
 	b.running = true
 	for b.running {
-		lowest = sequenceMax
-		for _, d := range b.dependencies {
-			if *d < lowest {
-				lowest = *d
-			}
-		}
-		b.committed = lowest
+		_, b.committed = b.pollBatch(&values)
 		runtime.Gosched()
 	}
 }
 
+// pollBatch returns the counts the barrier can move through without waiting, from its own count up
+// to but not including the lowest, or agreed, count of its dependencies. They are equal if there are
+// none. values is scratch space kept between calls.
+func (b *consumeBarrier) pollBatch(values *[]int64) (int64, int64) {
+	from := b.committed
+	if b.quorum == 0 {
+		return from, b.dependencies.lowest(sequenceMax)
+	}
+	if agreed, ok := b.agreed(values); ok && agreed > from {
+		return from, agreed
+	}
+	return from, from
+}
+
+// agreed returns the highest count reached by at least quorum of the dependencies, or false if there
+// are fewer dependencies than the quorum. values is scratch space kept between calls.
+func (b *consumeBarrier) agreed(values *[]int64) (int64, bool) {
+	deps := b.dependencies.list()
+	if len(deps) < b.quorum {
+		return 0, false
+	}
+	v := (*values)[:0]
+	for _, d := range deps {
+		v = append(v, atomic.LoadInt64(d))
+	}
+	// Insertion sort, highest first. A barrier only watches a handful of dependencies.
+	for i := 1; i < len(v); i++ {
+		for j := i; j > 0 && v[j] > v[j-1]; j-- {
+			v[j], v[j-1] = v[j-1], v[j]
+		}
+	}
+	*values = v
+	return v[b.quorum-1], true
+}
+
 // Stop breaks the loop cycle of the run.
 func (b *consumeBarrier) Stop() {
 	b.running = false
@@ -54,7 +104,25 @@ func (b *consumeBarrier) Committed() *int64 {
 	return &b.committed
 }
 
-// AddDependency is a setter for a dependency of this barrier.
+// AddDependency is a setter for a dependency of this barrier. It may be called while the barrier is
+// running, with d already positioned at or after the barrier's Sequence.
 func (b *consumeBarrier) AddDependency(d *int64) {
-	b.dependencies = append(b.dependencies, d)
+	b.dependencies.add(d)
+}
+
+// RemoveDependency removes a dependency while the barrier is running. It returns false if d was not
+// found.
+func (b *consumeBarrier) RemoveDependency(d *int64) bool {
+	return b.dependencies.remove(d)
+}
+
+// Sequence returns the lowest committed counter found among the dependencies.
+func (b *consumeBarrier) Sequence() int64 {
+	return atomic.LoadInt64(&b.committed)
+}
+
+// SetSequence positions the barrier at seq until Run catches up with the dependencies.
+// It must be called before the barrier is in use.
+func (b *consumeBarrier) SetSequence(seq int64) {
+	b.committed = seq
 }
@@ -0,0 +1,86 @@
+package ringo
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// Resetter clears a cell of a ring once every consumer is done with it, dropping any references it
+// holds so the garbage collector can free them a lap sooner. A schema is a Resetter.
+type Resetter interface {
+	Reset(index int64)
+}
+
+// ResetFunc adapts a function to a Resetter.
+type ResetFunc func(index int64)
+
+// Reset calls f(index).
+func (f ResetFunc) Reset(index int64) {
+	f(index)
+}
+
+// consumeClearer is a stage that resets each cell after the last consumer has committed it.
+// It depends on the last consumer, or the barrier over the last consumers, and the publisher depends
+// on the clearer in its place, so a cell is never reset while it is being read or written.
+type consumeClearer struct {
+	cachepad1  [8]int64
+	committed  int64 // Count of cells reset.
+	cachepad2  [7]int64
+	dependency *int64   // The committed register of the last consumer.
+	resetter   Resetter // Clears each cell.
+	running    bool     // Is this clearer chasing the dependency in a Run() loop?
+}
+
+// NewConsumeClearer is a factory function for returning a new instance of a consumeClearer.
+func NewConsumeClearer(r Resetter) *consumeClearer {
+	return &consumeClearer{
+		resetter: r,
+	}
+}
+
+// Run continually resets the cells the dependency has finished with until Stop is called.
+func (c *consumeClearer) Run() {
+	c.running = true
+	for c.running {
+		available := atomic.LoadInt64(c.dependency)
+		if available == c.committed {
+			runtime.Gosched()
+			continue
+		}
+		for index := c.committed; index < available; index++ {
+			c.resetter.Reset(index)
+		}
+		atomic.StoreInt64(&c.committed, available)
+	}
+}
+
+// Stop breaks the loop cycle of the run.
+func (c *consumeClearer) Stop() {
+	c.running = false
+}
+
+// Running returns the state of the running flag.
+func (c *consumeClearer) Running() bool {
+	return c.running
+}
+
+// Committed returns a pointer to the committed counter.
+func (c *consumeClearer) Committed() *int64 {
+	return &c.committed
+}
+
+// SetDependency sets the dependent commit counter of this node.
+func (c *consumeClearer) SetDependency(d *int64) {
+	c.dependency = d
+}
+
+// Sequence returns the index of the next cell to be reset.
+func (c *consumeClearer) Sequence() int64 {
+	return atomic.LoadInt64(&c.committed)
+}
+
+// SetSequence positions the clearer so the next cell reset is at seq.
+// It must be called before the clearer is in use.
+func (c *consumeClearer) SetSequence(seq int64) {
+	c.committed = seq
+}
@@ -0,0 +1,49 @@
+package ringo
+
+// consumePoller lets a caller that owns its loop, such as a game tick or a select over other sources,
+// consume from a simpleConsumeNode. Each Poll handles whatever is available without waiting, so ring
+// consumption can be interleaved with other work. The node is wired into the topology as usual; the
+// poller takes over its Reserve and Commit calls.
+type consumePoller struct {
+	node      *simpleConsumeNode // Tracks the events processed.
+	publisher sequencer          // The publisher, used to tell gating from idle.
+}
+
+// NewConsumePoller is a factory function for returning a new instance of a consumePoller.
+// p is the publisher of the ring. If the node depends on another stage rather than the publisher,
+// it lets Poll report PollGating instead of PollIdle while events are waiting on that stage.
+func NewConsumePoller(n *simpleConsumeNode, p sequencer) *consumePoller {
+	return &consumePoller{
+		node:      n,
+		publisher: p,
+	}
+}
+
+// Poll hands every event currently available to h and commits them. It never waits. If h returns an
+// error, it is returned with every event before the failed one committed, and the failed event is
+// handed over again by the next Poll.
+func (c *consumePoller) Poll(h Handler) (PollState, error) {
+	from, to := c.node.pollBatch()
+	if from == to {
+		if c.publisher.Sequence() > from {
+			return PollGating, nil
+		}
+		return PollIdle, nil
+	}
+	return PollProcessing, poll(h, from, to, c.commit)
+}
+
+// commit moves the node past the events processed, from up to but not including to.
+func (c *consumePoller) commit(from int64, to int64) {
+	c.node.CommitBatch(to)
+}
+
+// Node returns the node this poller drives.
+func (c *consumePoller) Node() *simpleConsumeNode {
+	return c.node
+}
+
+// Sequence returns the index of the next event to be processed.
+func (c *consumePoller) Sequence() int64 {
+	return c.node.Sequence()
+}
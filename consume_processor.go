@@ -0,0 +1,64 @@
+package ringo
+
+import (
+	"runtime"
+)
+
+// consumeProcessor runs a Handler over the events reaching a simpleConsumeNode. In its Run loop it
+// hands the handler every event the node's dependency has made available and then commits them as one
+// batch. The node is wired into the topology as usual; the processor takes over its Reserve and
+// Commit calls.
+type consumeProcessor struct {
+	node *simpleConsumeNode // Tracks the events processed.
+	processor
+}
+
+// NewConsumeProcessor is a factory function for returning a new instance of a consumeProcessor.
+func NewConsumeProcessor(n *simpleConsumeNode, h Handler) *consumeProcessor {
+	c := &consumeProcessor{
+		node: n,
+	}
+	c.init(h, c.commit)
+	return c
+}
+
+// Run continually processes the events made available to the node until Stop is called or the
+// handler returns an error. The error is returned with every event before the failed one committed.
+// Run may be called again after it returns, to carry on from the failed event.
+func (c *consumeProcessor) Run() (err error) {
+	if err := c.start(); err != nil {
+		return err
+	}
+	defer c.shutdown(&err)
+
+	for c.running {
+		c.park(c.node.Sequence())
+		from, to := c.node.pollBatch()
+		if from == to {
+			if err := c.idle(from); err != nil {
+				return err
+			}
+			runtime.Gosched()
+			continue
+		}
+		if err := c.process(from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit moves the node past the events processed, from up to but not including to.
+func (c *consumeProcessor) commit(from int64, to int64) {
+	c.node.CommitBatch(to)
+}
+
+// Node returns the node this processor drives.
+func (c *consumeProcessor) Node() *simpleConsumeNode {
+	return c.node
+}
+
+// Sequence returns the index of the next event to be processed.
+func (c *consumeProcessor) Sequence() int64 {
+	return c.node.Sequence()
+}
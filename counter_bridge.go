@@ -0,0 +1,76 @@
+package ringo
+
+import (
+	"math"
+	"runtime"
+	"sync/atomic"
+)
+
+// counterBridge presents the progress of a Type 2 node as a Type 1 committed counter. It follows the
+// status ring of its dependency and counts the cells completed in order, so Type 1 nodes can depend on
+// a Type 2 node through it.
+type counterBridge struct {
+	cachepad1  [8]int64
+	committed  int64 // Count of cells completed by the dependency, in order.
+	cachepad2  [7]int64
+	dependency []int32 // The status ring being followed.
+	mask       int64   // Used in place of modulo for index calculations.
+	shift      uint8   // Used to find the rotation a cell should be marked with.
+	running    bool    // Is this bridge chasing the dependency in a Run() loop?
+}
+
+// NewCounterBridge is a factory function for returning a new instance of a counterBridge for a ring
+// of size.
+func NewCounterBridge(size int64) *counterBridge {
+	return &counterBridge{
+		mask:  size - 1,
+		shift: uint8(math.Log2(float64(size))),
+	}
+}
+
+// Run continually counts the cells completed by the dependency until Stop is called.
+func (b *counterBridge) Run() {
+	b.running = true
+	for b.running {
+		next := b.committed
+		for next-b.committed <= b.mask && b.dependency[next&b.mask] == int32(next>>b.shift) {
+			next++
+		}
+		if next == b.committed {
+			runtime.Gosched()
+			continue
+		}
+		atomic.StoreInt64(&b.committed, next)
+	}
+}
+
+// Stop breaks the loop cycle of the run.
+func (b *counterBridge) Stop() {
+	b.running = false
+}
+
+// Running returns the state of the running flag.
+func (b *counterBridge) Running() bool {
+	return b.running
+}
+
+// Committed returns a pointer to the committed counter.
+func (b *counterBridge) Committed() *int64 {
+	return &b.committed
+}
+
+// SetDependency is a setter for the status ring this bridge follows.
+func (b *counterBridge) SetDependency(dep []int32) {
+	b.dependency = dep
+}
+
+// Sequence returns the count of cells completed by the dependency.
+func (b *counterBridge) Sequence() int64 {
+	return atomic.LoadInt64(&b.committed)
+}
+
+// SetSequence positions the bridge at seq, which should match its dependency.
+// It must be called before the bridge is in use.
+func (b *counterBridge) SetSequence(seq int64) {
+	b.committed = seq
+}
@@ -0,0 +1,70 @@
+package ringo
+
+import "fmt"
+
+// nodeDebug names a node and holds the state it needs to check its invariants on each Reserve and
+// Commit. The checks only run in builds with the ringodebug tag:
+//
+//	go test -tags ringodebug ./...
+//
+// Without the tag debugging is false and the checks compile away. A violation panics with the name of the
+// node and the sequences involved, so a wiring bug fails a test instead of silently corrupting data.
+// Only the publish and consume nodes embed it; barriers, bridges, clearers, broadcastReader and the
+// processors are not checked.
+type nodeDebug struct {
+	name    string // Identifies the node in invariant panics.
+	pending int64  // Type 1: reservations not yet committed.
+	next    int64  // Type 2: the index that must be committed next.
+}
+
+// SetName is a setter for the name used to identify this node in invariant panics.
+func (d *nodeDebug) SetName(name string) {
+	d.name = name
+}
+
+// Name is a getter for the name used to identify this node in invariant panics.
+func (d *nodeDebug) Name() string {
+	if d.name == "" {
+		return "unnamed node"
+	}
+	return d.name
+}
+
+// violated panics with a description of a broken invariant.
+func (d *nodeDebug) violated(format string, args ...interface{}) {
+	panic(fmt.Sprintf("ringo: invariant violated by %s: %s", d.Name(), fmt.Sprintf(format, args...)))
+}
+
+// reserved records a Type 1 reservation, which must not be made while another is outstanding.
+func (d *nodeDebug) reserved(index int64) {
+	if d.pending != 0 {
+		d.violated("Reserve of %d before Commit of the previous reservation", index)
+	}
+	d.pending = 1
+}
+
+// committing checks that a Type 1 Commit has a reservation to commit.
+func (d *nodeDebug) committing(index int64) {
+	if d.pending != 1 {
+		d.violated("Commit of %d without a Reserve", index)
+	}
+	d.pending = 0
+}
+
+// stamping checks that a Type 2 Commit of index moves the rotation stamp of its cell forward.
+func (d *nodeDebug) stamping(ring []int32, index int64, mask int64, shift uint8) {
+	if stamp := ring[index&mask]; stamp-int32(index>>shift) >= 0 {
+		d.violated("Commit of %d would move the rotation of its cell from %d back to %d", index, stamp,
+			index>>shift)
+	}
+}
+
+// gated checks that a Type 2 node's dependency has completed the cell it depends on before index is
+// committed. For a leader, whose barrier is the ring size, that means it is at most a lap ahead.
+func (d *nodeDebug) gated(dep []int32, index int64, barrier int64, mask int64, shift uint8) {
+	gate := index - barrier
+	if stamp := dep[index&mask]; stamp-int32(gate>>shift) < 0 {
+		d.violated("Commit of %d before its dependency completed %d (cell rotation %d, expected %d)",
+			index, gate, stamp, gate>>shift)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !ringodebug
+// +build !ringodebug
+
+package ringo
+
+// debugging turns on the invariant checks of every node. Build with the ringodebug tag to set it.
+const debugging = false
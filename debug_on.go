@@ -0,0 +1,7 @@
+//go:build ringodebug
+// +build ringodebug
+
+package ringo
+
+// debugging turns on the invariant checks of every node.
+const debugging = true
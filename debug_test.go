@@ -0,0 +1,111 @@
+//go:build ringodebug
+// +build ringodebug
+
+package ringo
+
+import (
+	"strings"
+	"testing"
+)
+
+// violation runs fn and reports whether it panicked naming the node.
+func violation(t *testing.T, name string, fn func()) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		r := recover()
+		if r == nil {
+			t.Errorf("Expected %s to panic", name)
+			return
+		}
+		if msg, ok := r.(string); !ok || !strings.Contains(msg, name) {
+			t.Errorf("Expected a panic naming %s, got %v", name, r)
+		}
+	}()
+	fn()
+}
+
+// Type 1 nodes must pair Reserve and Commit, and not overtake the nodes they depend on.
+func TestDebugType1(t *testing.T) {
+	publisher := NewSimplePublishNode(4)
+	publisher.SetName("publisher")
+	consumer := NewSimpleConsumeNode()
+	consumer.SetName("consumer")
+	consumer.SetDependency(publisher.Committed())
+	publisher.SetDependency(consumer.Committed())
+
+	violation(t, "publisher", publisher.Commit)
+	publisher.Reserve()
+	violation(t, "publisher", func() { publisher.Reserve() })
+	publisher.Commit()
+
+	// A consumer committing work it never reserved, or work its dependency has not published.
+	violation(t, "consumer", consumer.Commit)
+	violation(t, "consumer", func() { consumer.CommitBatch(2) })
+	consumer.Reserve()
+	consumer.Commit()
+
+	// A consumer attached a lap behind while the publisher holds a reservation.
+	for i := 0; i < 3; i++ {
+		publisher.Reserve()
+		publisher.Commit()
+	}
+	publisher.Reserve()
+	publisher.AddDependency(NewSimpleConsumeNode().Committed())
+	violation(t, "publisher", publisher.Commit)
+
+	multi := NewMultiPublishNode(4)
+	multi.SetName("multi")
+	multi.SetDependency(consumer.Committed())
+	violation(t, "multi", multi.Commit)
+}
+
+// Type 2 nodes must commit in order, after their dependency, and only move their stamps forward.
+func TestDebugType2(t *testing.T) {
+	publisher := NewSimpleNode(true, 4)
+	publisher.SetName("publisher")
+	consumer := NewSimpleNode(false, 4)
+	consumer.SetName("consumer")
+	consumer.SetDependency(publisher.Committed())
+	publisher.SetDependency(consumer.Committed())
+
+	violation(t, "publisher", func() { publisher.Commit(0) })
+	publisher.Reserve()
+	publisher.Reserve()
+	violation(t, "publisher", func() { publisher.Commit(1) })
+	publisher.Commit(0)
+
+	// The consumer reserves a cell the publisher has not committed.
+	consumer.cursor = 1
+	consumer.Commit(0)
+	violation(t, "consumer", func() { consumer.Commit(1) })
+
+	// A node stamping a cell with an earlier rotation than it already holds.
+	multi := NewMultiNode(false, 4)
+	multi.SetName("multi")
+	multi.SetDependency(publisher.Committed())
+	multi.Reserve()
+	multi.Commit(0)
+	violation(t, "multi", func() { multi.Commit(0) })
+	violation(t, "multi", func() { multi.Commit(3) })
+}
+
+// Without mistakes the checks stay quiet, including for an evicting publisher.
+func TestDebugDropOldest(t *testing.T) {
+	publisher := NewSimpleNode(true, 4)
+	publisher.SetPolicy(PolicyDropOldest)
+	consumer := NewSimpleNode(false, 4)
+	consumer.SetDependency(publisher.Committed())
+	publisher.SetDependency(consumer.Committed())
+
+	for i := 0; i < 10; i++ {
+		ndx, err := publisher.TryReserve()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		publisher.Commit(ndx)
+	}
+	if publisher.Name() != "unnamed node" {
+		t.Errorf("Expected the default name, got %s", publisher.Name())
+	}
+}
@@ -16,10 +16,10 @@ import (
 // The original Publisher uses this Application Consumer as a dependency to know whether it can
 // publish more events into the ring e.g. whether the ring is full.
 // For this example, the topology will be:
-// 1 MultiPublishNode(3 goroutines) *=> 2 SimpleConsumeNodes(journal/send) => Barrier => 1 SimpleConsumeNode(app)
-//         ^^                                                                                    VV
-//         ||--------------------------------------- <== dependency <== -------------------------||
 //
+//	1 MultiPublishNode(3 goroutines) *=> 2 SimpleConsumeNodes(journal/send) => Barrier => 1 SimpleConsumeNode(app)
+//	        ^^                                                                                    VV
+//	        ||--------------------------------------- <== dependency <== -------------------------||
 func TestDisruptorSmallType1(t *testing.T) {
 	prevProcs := runtime.GOMAXPROCS(-1)
 	runtime.GOMAXPROCS(runtime.NumCPU())
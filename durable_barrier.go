@@ -0,0 +1,110 @@
+package ringo
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// SyncPolicy decides when a durableBarrier forces journaled events to disk. Either threshold
+// triggers a sync. If both are zero, every batch the journaler writes is synced as soon as it is seen.
+// An Events threshold without an Interval also syncs whenever the journaler has caught up with its
+// input, so a trailing group smaller than the threshold is never left waiting for events that may
+// not come.
+type SyncPolicy struct {
+	Events   int64         // Sync once this many events are waiting. Zero disables.
+	Interval time.Duration // Sync once the oldest waiting event has waited this long. Zero disables.
+}
+
+// durableBarrier is a group commit stage that sits behind a journaler. Its committed counter only
+// moves past an event once the fsync covering it has completed, so a consumer acknowledging events
+// can depend on the barrier in the same way it would depend on a consumeBarrier, and never
+// acknowledge anything that could be lost in a crash. Syncing many events at once keeps the cost of
+// each fsync spread over the group.
+type durableBarrier struct {
+	cachepad1 [8]int64
+	committed int64 // Count of events known to be on disk.
+	cachepad2 [7]int64
+	journaler *journaler // The journaler whose writes are being made durable.
+	policy    SyncPolicy // When to sync.
+	running   bool       // Is this Barrier chasing the journaler in a Run() loop?
+}
+
+// NewDurableBarrier is a factory function for returning a new instance of a durableBarrier.
+// The journaler stops syncing at the end of each batch and leaves it to the barrier.
+func NewDurableBarrier(j *journaler, p SyncPolicy) *durableBarrier {
+	j.sync = false
+	return &durableBarrier{
+		journaler: j,
+		policy:    p,
+	}
+}
+
+// Run continually syncs the journal according to the policy until Stop is called or a sync fails.
+// The error is returned and nothing further is committed.
+func (b *durableBarrier) Run() error {
+	var waiting time.Time // When the oldest unsynced event was first seen.
+	b.running = true
+	for b.running {
+		written := atomic.LoadInt64(&b.journaler.committed)
+		pending := written - b.committed
+		if pending == 0 {
+			runtime.Gosched()
+			continue
+		}
+		if waiting.IsZero() {
+			waiting = time.Now()
+		}
+		idle := written == atomic.LoadInt64(b.journaler.dependency)
+		if !b.due(pending, waiting, idle) {
+			runtime.Gosched()
+			continue
+		}
+
+		if err := b.journaler.journal.SyncFile(); err != nil {
+			b.running = false
+			return err
+		}
+		atomic.StoreInt64(&b.committed, written)
+		waiting = time.Time{}
+	}
+	return nil
+}
+
+// Stop breaks the loop cycle of the run.
+func (b *durableBarrier) Stop() {
+	b.running = false
+}
+
+// Running returns the state of the running flag.
+func (b *durableBarrier) Running() bool {
+	return b.running
+}
+
+// Committed returns a pointer to the committed counter.
+func (b *durableBarrier) Committed() *int64 {
+	return &b.committed
+}
+
+// due reports whether pending events, the oldest seen at waiting, should be synced now. idle is true
+// if the journaler has written everything available to it.
+func (b *durableBarrier) due(pending int64, waiting time.Time, idle bool) bool {
+	if b.policy.Interval == 0 {
+		return b.policy.Events == 0 || pending >= b.policy.Events || idle
+	}
+	if b.policy.Events > 0 && pending >= b.policy.Events {
+		return true
+	}
+	return time.Since(waiting) >= b.policy.Interval
+}
+
+// Sequence returns the count of events known to be on disk.
+func (b *durableBarrier) Sequence() int64 {
+	return atomic.LoadInt64(&b.committed)
+}
+
+// SetSequence positions the barrier at seq, which should match its journaler.
+// It must be called before the barrier is in use.
+func (b *durableBarrier) SetSequence(seq int64) {
+	b.committed = seq
+}
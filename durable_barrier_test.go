@@ -0,0 +1,106 @@
+package ringo
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Acknowledge events only once they are on disk:
+// 1 SimplePublishNode => Journaler => DurableBarrier => 1 SimpleConsumeNode(ack)
+func TestDurableBarrier(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	policies := map[string]SyncPolicy{
+		"batch":    {},
+		"events":   {Events: 16, Interval: time.Millisecond},
+		"trailing": {Events: 16}, // 500 events leave a trailing group of 4.
+		"interval": {Interval: 200 * time.Microsecond},
+	}
+	for name, policy := range policies {
+		dir := t.TempDir()
+		ring := make([]int64, 32)
+		j, err := OpenJournal(dir, 1024)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		// Build the components
+		publisher := NewSimplePublishNode(32)
+		journaler := NewJournaler(j, &int64Codec{ring: ring})
+		durable := NewDurableBarrier(journaler, policy)
+		ack := NewSimpleConsumeNode()
+
+		// Link the committed counter dependencies together.
+		journaler.SetDependency(publisher.Committed())
+		ack.SetDependency(durable.Committed())
+		publisher.SetDependency(ack.Committed())
+
+		done := make(chan bool)
+		errs := make(chan error, 2)
+
+		go func() {
+			errs <- journaler.Run()
+		}()
+
+		go func() {
+			errs <- durable.Run()
+		}()
+
+		go func() {
+			for i := int64(0); i < 500; i++ {
+				index := ack.Reserve()
+				if *index >= atomic.LoadInt64(durable.Committed()) {
+					t.Errorf("%s: acknowledged %d before it was durable.", name, *index)
+				}
+				ack.Commit()
+			}
+			done <- true
+		}()
+
+		for i := int64(0); i < 500; i++ {
+			index := publisher.Reserve()
+			ring[*index&31] = i * 10
+			publisher.Commit()
+		}
+
+		<-done
+		durable.Stop()
+		journaler.Stop()
+		for i := 0; i < 2; i++ {
+			if err := <-errs; err != nil {
+				t.Errorf("%s: unexpected error: %s", name, err)
+			}
+		}
+		j.Close()
+
+		if next, err := ReadJournal(dir, 0, func(int64, []byte) error { return nil }); next != 500 || err != nil {
+			t.Errorf("%s: expected to read up to 500, got %d %v.", name, next, err)
+		}
+	}
+}
+
+func TestDurableBarrierDue(t *testing.T) {
+	b := &durableBarrier{policy: SyncPolicy{Events: 10, Interval: time.Hour}}
+	if b.due(9, time.Now(), true) {
+		t.Errorf("Expected 9 events not to be due.")
+	}
+	if !b.due(10, time.Now(), false) {
+		t.Errorf("Expected 10 events to be due.")
+	}
+	if !b.due(1, time.Now().Add(-2*time.Hour), false) {
+		t.Errorf("Expected an event waiting two hours to be due.")
+	}
+
+	// Without an interval, a partial group is synced once the journaler runs out of input.
+	b = &durableBarrier{policy: SyncPolicy{Events: 10}}
+	if b.due(4, time.Now().Add(-2*time.Hour), false) {
+		t.Errorf("Expected 4 events not to be due while more are being written.")
+	}
+	if !b.due(4, time.Now(), true) {
+		t.Errorf("Expected a trailing group of 4 events to be due.")
+	}
+}
@@ -0,0 +1,66 @@
+package ringo
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// gatingSet is a set of committed counters that can be changed while it is being read, such as the
+// consumers a publisher must not overtake. Changes copy the set and swap it in whole, so readers in a
+// hot loop never take a lock.
+type gatingSet struct {
+	mu       sync.Mutex   // Serializes changes.
+	counters atomic.Value // The current []*int64.
+}
+
+// list returns the current counters.
+func (g *gatingSet) list() []*int64 {
+	counters, _ := g.counters.Load().([]*int64)
+	return counters
+}
+
+// set replaces the counters with d alone.
+func (g *gatingSet) set(d *int64) {
+	g.mu.Lock()
+	g.counters.Store([]*int64{d})
+	g.mu.Unlock()
+}
+
+// add adds d to the counters.
+func (g *gatingSet) add(d *int64) {
+	g.mu.Lock()
+	old := g.list()
+	counters := make([]*int64, len(old), len(old)+1)
+	copy(counters, old)
+	g.counters.Store(append(counters, d))
+	g.mu.Unlock()
+}
+
+// remove removes d from the counters, returning false if it was not there.
+func (g *gatingSet) remove(d *int64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	old := g.list()
+	counters := make([]*int64, 0, len(old))
+	for _, c := range old {
+		if c != d {
+			counters = append(counters, c)
+		}
+	}
+	if len(counters) == len(old) {
+		return false
+	}
+	g.counters.Store(counters)
+	return true
+}
+
+// lowest returns the lowest of the counters, or none if there are none.
+func (g *gatingSet) lowest(none int64) int64 {
+	lowest := none
+	for i, c := range g.list() {
+		if v := atomic.LoadInt64(c); i == 0 || v < lowest {
+			lowest = v
+		}
+	}
+	return lowest
+}
@@ -0,0 +1,224 @@
+package ringo
+
+import (
+	"runtime"
+	"testing"
+)
+
+// An audit tap attached to a running publisher and detached again while it keeps publishing:
+// 1 SimplePublishNode => 1 SimpleConsumeNode + 1 tap SimpleConsumeNode
+func TestAttachTapType1(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := make([]int64, 32)
+	publisher := NewSimplePublishNode(32)
+	consumer := NewSimpleConsumeNode()
+	publisher.SetDependency(consumer.Committed())
+	consumer.SetDependency(publisher.Committed())
+
+	done := make(chan int64)
+	detached := make(chan bool)
+
+	// The consumer reads until the end marker.
+	go func() {
+		var count int64
+		for {
+			ndx := *consumer.Reserve()
+			v := ring[ndx&31]
+			consumer.Commit()
+			if v < 0 {
+				done <- count
+				return
+			}
+			count++
+		}
+	}()
+
+	// The tap joins part way through, reads 500 events and leaves.
+	go func() {
+		for publisher.Sequence() < 1000 {
+			runtime.Gosched()
+		}
+		tap := NewSimpleConsumeNode()
+		publisher.Attach(tap)
+		start := tap.Sequence()
+		for i := int64(0); i < 500; i++ {
+			ndx := *tap.Reserve()
+			if ndx != start+i || ring[ndx&31] != ndx {
+				t.Errorf("Expected %d at %d, got %d at %d", start+i, start+i, ring[ndx&31], ndx)
+			}
+			tap.Commit()
+		}
+		if !publisher.RemoveDependency(tap.Committed()) {
+			t.Error("Expected the tap to be removed")
+		}
+		close(detached)
+	}()
+
+	// Publish until the tap has come and gone, then some more.
+	var published int64
+	publish := func() {
+		ndx := *publisher.Reserve()
+		ring[ndx&31] = ndx
+		publisher.Commit()
+		published++
+	}
+	for i := 0; i < 10000; i++ {
+		publish()
+	}
+	for waiting := true; waiting; {
+		select {
+		case <-detached:
+			waiting = false
+		default:
+			publish()
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		publish()
+	}
+	ndx := *publisher.Reserve()
+	ring[ndx&31] = -1
+	publisher.Commit()
+
+	if count := <-done; count != published {
+		t.Errorf("Expected %d events, got %d", published, count)
+	}
+	if publisher.RemoveDependency(&published) {
+		t.Error("Expected an unknown dependency not to be removed")
+	}
+}
+
+// A consumer leaving a running barrier, so the publisher carries on without it:
+// 1 MultiPublishNode => 2 SimpleConsumeNode => Barrier
+func TestRemoveDependencyType1(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	// Build the components
+	publisher := NewMultiPublishNode(32)
+	consumer1 := NewSimpleConsumeNode()
+	consumer2 := NewSimpleConsumeNode()
+	barrier := NewConsumeBarrier()
+
+	// Link the committed counter dependencies together.
+	consumer1.SetDependency(publisher.Committed())
+	consumer2.SetDependency(publisher.Committed())
+	barrier.AddDependency(consumer1.Committed())
+	barrier.AddDependency(consumer2.Committed())
+	publisher.SetDependency(barrier.Committed())
+
+	done := make(chan bool)
+
+	go func() {
+		for i := int64(0); i < 1000; i++ {
+			consumer1.Reserve()
+			consumer1.Commit()
+		}
+		done <- true
+	}()
+
+	// Consumer 2 leaves after 100 events.
+	go func() {
+		for i := int64(0); i < 100; i++ {
+			consumer2.Reserve()
+			consumer2.Commit()
+		}
+		if !barrier.RemoveDependency(consumer2.Committed()) {
+			t.Error("Expected consumer 2 to be removed")
+		}
+		if barrier.RemoveDependency(consumer2.Committed()) {
+			t.Error("Expected consumer 2 to be removed only once")
+		}
+	}()
+
+	go func() {
+		barrier.Run()
+	}()
+
+	for i := int64(0); i < 1000; i++ {
+		publisher.Reserve()
+		publisher.Commit()
+	}
+	<-done
+	barrier.Stop()
+}
+
+// A Type 2 barrier losing one consumer and gaining another while running:
+// 1 SimpleNode => 2 SimpleNode => Barrier
+func TestChangeDependenciesType2(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	// Build the components
+	publisher := NewSimpleNode(true, 32)
+	consumer1 := NewSimpleNode(false, 32)
+	consumer2 := NewSimpleNode(false, 32)
+	barrier := NewNodeBarrier(32)
+
+	// Link the committed counter dependencies together.
+	consumer1.SetDependency(publisher.Committed())
+	consumer2.SetDependency(publisher.Committed())
+	barrier.AddDependency(consumer1.Committed())
+	barrier.AddDependency(consumer2.Committed())
+	publisher.SetDependency(barrier.Committed())
+
+	done := make(chan bool)
+
+	go func() {
+		for i := int64(0); i < 1000; i++ {
+			ndx := consumer1.Reserve()
+			consumer1.Commit(ndx)
+		}
+		done <- true
+	}()
+
+	// Consumer 2 leaves after 100 events.
+	go func() {
+		for i := int64(0); i < 100; i++ {
+			ndx := consumer2.Reserve()
+			consumer2.Commit(ndx)
+		}
+		if !barrier.RemoveDependency(consumer2.Committed()) {
+			t.Error("Expected consumer 2 to be removed")
+		}
+	}()
+
+	go func() {
+		barrier.Run()
+	}()
+
+	for i := int64(0); i < 1000; i++ {
+		if i == 500 {
+			// Once everything has caught up, a tap joins at the barrier's position.
+			for barrier.Sequence() < 500 {
+				runtime.Gosched()
+			}
+			tap := NewSimpleNode(false, 32)
+			tap.SetDependency(publisher.Committed())
+			tap.SetSequence(barrier.Sequence())
+			barrier.AddDependency(tap.Committed())
+			go func() {
+				for i := int64(500); i < 1000; i++ {
+					if ndx := tap.Reserve(); ndx != i {
+						t.Errorf("Expected %d, got %d", i, ndx)
+					}
+					tap.Commit(i)
+				}
+				done <- true
+			}()
+		}
+		ndx := publisher.Reserve()
+		publisher.Commit(ndx)
+	}
+	<-done
+	<-done
+	for barrier.Sequence() < 1000 {
+		runtime.Gosched()
+	}
+	barrier.Stop()
+}
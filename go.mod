@@ -0,0 +1,3 @@
+module github.com/composer22/ringo-mundo
+
+go 1.16
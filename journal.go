@@ -0,0 +1,432 @@
+package ringo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Journal files are made up of segments. Each segment starts with a header, followed by records:
+//
+//	header: magic [4]byte "RNGJ" | version uint32 | first sequence int64
+//	record: payload length uint32 | crc32 uint32 | sequence int64 | payload
+//
+// All integers are little endian. The checksum covers the sequence and payload. Segments are
+// named after the first sequence they hold, so they sort in journal order.
+const (
+	journalMagic        = "RNGJ"
+	journalVersion      = 1
+	journalExt          = ".journal"
+	journalHeaderLength = 16
+	journalRecordHeader = 16
+)
+
+var (
+	// ErrJournalCorrupt is returned when a record fails its checksum before the end of a journal.
+	ErrJournalCorrupt = errors.New("ringo: journal is corrupt")
+
+	// ErrJournalSequence is returned when events are appended to a journal out of order.
+	ErrJournalSequence = errors.New("ringo: journal sequence out of order")
+
+	// errStopScan ends a segment scan early.
+	errStopScan = errors.New("ringo: stop scan")
+
+	journalTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// Codec converts the events in a ring to and from bytes for the journal.
+// An implementation normally holds the ring it is encoding from or decoding into.
+type Codec interface {
+	// Encode appends the encoding of the event in the cell for seq to buf and returns the result.
+	Encode(buf []byte, seq int64) ([]byte, error)
+
+	// Decode stores the event encoded in data into the cell for seq.
+	Decode(seq int64, data []byte) error
+}
+
+// journal is an append only log of events split into size rotated segment files.
+// Only one go routine may append to a journal, although another may force it to disk with SyncFile.
+type journal struct {
+	dir         string        // Directory holding the segment files.
+	segmentSize int64         // Size at which a new segment is started.
+	mu          sync.Mutex    // Keeps the file from being switched during a SyncFile.
+	file        *os.File      // The segment being appended to.
+	writer      *bufio.Writer // Buffers records on their way to the file.
+	size        int64         // Bytes written to the current segment.
+	next        int64         // Sequence of the next record to append.
+	empty       bool          // True until the first record is appended.
+	header      [journalRecordHeader]byte
+}
+
+// OpenJournal is a factory function that opens the journal in dir for appending, creating dir if
+// needed. A torn record at the end of the last segment, left by a crash, is truncated away.
+// segmentSize is the size in bytes at which segments are rotated.
+func OpenJournal(dir string, segmentSize int64) (*journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	j := &journal{
+		dir:         dir,
+		segmentSize: segmentSize,
+		empty:       true,
+	}
+
+	segments, err := JournalSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the end of the last good record and carry on from there. A segment whose header never
+	// made it to disk is removed.
+	var last JournalSegment
+	var end, next int64
+	for end == 0 {
+		if len(segments) == 0 {
+			return j, nil
+		}
+		last, segments = segments[len(segments)-1], segments[:len(segments)-1]
+		end, next, err = scanSegment(last.Path, func(int64, []byte) error { return nil })
+		if err != nil && err != ErrJournalCorrupt {
+			return nil, err
+		}
+		if end == 0 {
+			if err = os.Remove(last.Path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if j.file, err = os.OpenFile(last.Path, os.O_RDWR, 0644); err != nil {
+		return nil, err
+	}
+	if err = j.file.Truncate(end); err == nil {
+		_, err = j.file.Seek(end, io.SeekStart)
+	}
+	if err != nil {
+		j.file.Close()
+		return nil, err
+	}
+	j.writer = bufio.NewWriter(j.file)
+	j.size = end
+	j.next = next
+	j.empty = false
+	return j, nil
+}
+
+// Append adds the event for seq to the journal. Records are buffered until Sync is called.
+func (j *journal) Append(seq int64, payload []byte) error {
+	if !j.empty && seq != j.next {
+		return ErrJournalSequence
+	}
+	length := int64(journalRecordHeader + len(payload))
+	if j.file == nil || (j.size+length > j.segmentSize && j.size > journalHeaderLength) {
+		if err := j.rotate(seq); err != nil {
+			return err
+		}
+	}
+
+	binary.LittleEndian.PutUint32(j.header[0:], uint32(len(payload)))
+	binary.LittleEndian.PutUint64(j.header[8:], uint64(seq))
+	crc := crc32.Update(0, journalTable, j.header[8:])
+	binary.LittleEndian.PutUint32(j.header[4:], crc32.Update(crc, journalTable, payload))
+	if _, err := j.writer.Write(j.header[:]); err != nil {
+		return err
+	}
+	if _, err := j.writer.Write(payload); err != nil {
+		return err
+	}
+	j.size += length
+	j.next = seq + 1
+	j.empty = false
+	return nil
+}
+
+// Flush hands buffered records to the operating system without waiting for the disk.
+func (j *journal) Flush() error {
+	if j.file == nil {
+		return nil
+	}
+	return j.writer.Flush()
+}
+
+// Sync flushes buffered records and forces them to disk.
+func (j *journal) Sync() error {
+	if err := j.Flush(); err != nil {
+		return err
+	}
+	return j.SyncFile()
+}
+
+// SyncFile forces every record already flushed to disk. Earlier segments were synced when they
+// were rotated, so only the current segment needs it. Unlike the other functions this may be called
+// from a go routine other than the one appending.
+func (j *journal) SyncFile() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Sync()
+}
+
+// Close syncs and closes the journal.
+func (j *journal) Close() error {
+	if j.file == nil {
+		return nil
+	}
+	err := j.Sync()
+	j.mu.Lock()
+	if cerr := j.file.Close(); err == nil {
+		err = cerr
+	}
+	j.file = nil
+	j.mu.Unlock()
+	return err
+}
+
+// Next returns the sequence of the next record to be appended.
+func (j *journal) Next() int64 {
+	return j.next
+}
+
+// rotate closes off the current segment and starts a new one beginning at seq.
+func (j *journal) rotate(seq int64) error {
+	if err := j.Close(); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(segmentPath(j.dir, seq), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	var header [journalHeaderLength]byte
+	copy(header[:], journalMagic)
+	binary.LittleEndian.PutUint32(header[4:], journalVersion)
+	binary.LittleEndian.PutUint64(header[8:], uint64(seq))
+	if _, err = file.Write(header[:]); err == nil {
+		err = syncDir(j.dir)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	j.mu.Lock()
+	j.file = file
+	j.mu.Unlock()
+	j.writer = bufio.NewWriter(file)
+	j.size = journalHeaderLength
+	return nil
+}
+
+// syncDir forces the directory entries of dir to disk so new segments survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// JournalSegment describes one segment file of a journal.
+type JournalSegment struct {
+	Path  string // Location of the file.
+	First int64  // Sequence of the first record in the file.
+	Size  int64  // Size of the file in bytes.
+}
+
+// JournalSegments lists the segments of the journal in dir in journal order.
+func JournalSegments(dir string) ([]JournalSegment, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*"+journalExt))
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]JournalSegment, 0, len(names))
+	for _, name := range names {
+		first, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(name), journalExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, JournalSegment{Path: name, First: first, Size: info.Size()})
+	}
+	sort.Slice(segments, func(a, b int) bool { return segments[a].First < segments[b].First })
+	return segments, nil
+}
+
+// segmentPath returns the name of the segment starting at seq.
+func segmentPath(dir string, seq int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", seq, journalExt))
+}
+
+// scanSegment reads every record of a segment in order and hands it to fn. It returns the offset
+// just past the last good record and the sequence following it. ErrJournalCorrupt is returned if a
+// record is torn or fails its checksum; the records before it are still valid.
+func scanSegment(path string, fn func(seq int64, data []byte) error) (int64, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+
+	var header [journalHeaderLength]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return 0, 0, ErrJournalCorrupt
+	}
+	if string(header[:4]) != journalMagic || binary.LittleEndian.Uint32(header[4:]) != journalVersion {
+		return 0, 0, ErrJournalCorrupt
+	}
+	offset := int64(journalHeaderLength)
+	next := int64(binary.LittleEndian.Uint64(header[8:]))
+
+	var payload []byte
+	for {
+		if _, err := io.ReadFull(reader, header[:]); err == io.EOF {
+			return offset, next, nil
+		} else if err != nil {
+			return offset, next, ErrJournalCorrupt
+		}
+		length := binary.LittleEndian.Uint32(header[0:])
+		seq := int64(binary.LittleEndian.Uint64(header[8:]))
+		if int64(cap(payload)) < int64(length) {
+			payload = make([]byte, length)
+		}
+		payload = payload[:length]
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return offset, next, ErrJournalCorrupt
+		}
+		crc := crc32.Update(0, journalTable, header[8:])
+		if seq != next || binary.LittleEndian.Uint32(header[4:]) != crc32.Update(crc, journalTable, payload) {
+			return offset, next, ErrJournalCorrupt
+		}
+		if err := fn(seq, payload); err != nil {
+			return offset, next, err
+		}
+		offset += journalRecordHeader + int64(length)
+		next = seq + 1
+	}
+}
+
+// ReadJournal hands every event in the journal in dir, starting at sequence from, to fn in order.
+// The data slice is reused between calls. It returns the sequence following the last event read.
+// A torn record at the very end of the journal, left by a crash, marks the end of the journal.
+func ReadJournal(dir string, from int64, fn func(seq int64, data []byte) error) (int64, error) {
+	segments, err := JournalSegments(dir)
+	if err != nil {
+		return from, err
+	}
+	next := from
+	for i, segment := range segments {
+		// Skip segments that end before from.
+		if i+1 < len(segments) && segments[i+1].First <= from {
+			continue
+		}
+		_, next, err = scanSegment(segment.Path, func(seq int64, data []byte) error {
+			if seq < from {
+				return nil
+			}
+			return fn(seq, data)
+		})
+		if err == ErrJournalCorrupt && i+1 == len(segments) {
+			err = nil
+		}
+		if err != nil {
+			return next, err
+		}
+	}
+	if next < from {
+		next = from
+	}
+	return next, nil
+}
+
+// VerifyJournal checks the checksum of every record in the journal in dir and that sequences run on
+// without gaps, both within and between segments. It returns the sequence following the last good
+// record and, if a problem was found, an error naming the segment and offset. Unlike ReadJournal,
+// a torn record at the end of the journal is reported.
+func VerifyJournal(dir string) (int64, error) {
+	segments, err := JournalSegments(dir)
+	if err != nil || len(segments) == 0 {
+		return 0, err
+	}
+	next := segments[0].First
+	for _, segment := range segments {
+		if segment.First != next {
+			return next, fmt.Errorf("%s: starts at sequence %d, expected %d: %w", segment.Path,
+				segment.First, next, ErrJournalSequence)
+		}
+		var offset int64
+		if offset, next, err = scanSegment(segment.Path, func(int64, []byte) error { return nil }); err != nil {
+			return next, fmt.Errorf("%s: offset %d, sequence %d: %w", segment.Path, offset, next, err)
+		}
+	}
+	return next, nil
+}
+
+// TruncateJournal removes every record at or after sequence seq from the journal in dir.
+func TruncateJournal(dir string, seq int64) error {
+	segments, err := JournalSegments(dir)
+	if err != nil {
+		return err
+	}
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		if segment.First >= seq {
+			if err := os.Remove(segment.Path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Cut the segment holding seq just before its record.
+		end, _, err := scanSegment(segment.Path, func(s int64, _ []byte) error {
+			if s == seq {
+				return errStopScan
+			}
+			return nil
+		})
+		if err != nil && err != errStopScan && err != ErrJournalCorrupt {
+			return err
+		}
+		if err := os.Truncate(segment.Path, end); err != nil {
+			return err
+		}
+		break
+	}
+	return syncDir(dir)
+}
+
+// Replay re-publishes every event in the journal in dir, starting at sequence from, into a ring
+// through a simplePublishNode. Each event is decoded into the cell reserved for it with the codec.
+// This is used at startup to rebuild application state, so the journaler itself should not yet be
+// wired in behind the publisher. The publisher must be positioned at from, with SetSequence if from
+// is not zero, and each event must land in the cell of its own sequence: if the publisher is
+// elsewhere, or segments are missing, an error wrapping ErrJournalSequence is returned instead.
+// It returns the sequence following the last event replayed.
+func Replay(dir string, from int64, c Codec, p *simplePublishNode) (int64, error) {
+	return ReadJournal(dir, from, func(seq int64, data []byte) error {
+		if next := p.Sequence(); seq != next {
+			return fmt.Errorf("ringo: replaying sequence %d, expected %d: %w", seq, next, ErrJournalSequence)
+		}
+		index := p.Reserve()
+		if err := c.Decode(*index, data); err != nil {
+			return err
+		}
+		p.Commit()
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+package ringo
+
+import (
+	"sort"
+	"sync"
+)
+
+// JournalDecoder turns the payload of a journal record into a value that can be marshalled to JSON.
+// Tools such as cmd/ringo-journal use registered decoders to print records.
+type JournalDecoder func(seq int64, data []byte) (interface{}, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = make(map[string]JournalDecoder)
+)
+
+// RegisterJournalDecoder makes a decoder available by name. It is intended to be called from the
+// init function of the package that defines the events, in the same way database/sql drivers are
+// registered. Registering the same name twice panics.
+func RegisterJournalDecoder(name string, d JournalDecoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	if d == nil {
+		panic("ringo: RegisterJournalDecoder decoder is nil")
+	}
+	if _, dup := decoders[name]; dup {
+		panic("ringo: RegisterJournalDecoder called twice for " + name)
+	}
+	decoders[name] = d
+}
+
+// LookupJournalDecoder returns the decoder registered under name.
+func LookupJournalDecoder(name string) (JournalDecoder, bool) {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	d, ok := decoders[name]
+	return d, ok
+}
+
+// JournalDecoders returns the sorted names of the registered decoders.
+func JournalDecoders() []string {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	names := make([]string, 0, len(decoders))
+	for name := range decoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
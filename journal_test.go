@@ -0,0 +1,287 @@
+package ringo
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+)
+
+// int64Codec journals a ring of int64 values.
+type int64Codec struct {
+	ring []int64
+}
+
+func (c *int64Codec) Encode(buf []byte, seq int64) ([]byte, error) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(c.ring[seq&int64(len(c.ring)-1)]))
+	return append(buf, b[:]...), nil
+}
+
+func (c *int64Codec) Decode(seq int64, data []byte) error {
+	c.ring[seq&int64(len(c.ring)-1)] = int64(binary.LittleEndian.Uint64(data))
+	return nil
+}
+
+// The disruptor example with consumer 1 acting as a real journaler:
+// 1 SimplePublishNode => Journaler + SimpleConsumeNode => Barrier => 1 SimpleConsumeNode
+func TestJournalDisruptor(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	dir := t.TempDir()
+	ring := make([]int64, 32)
+	j, err := OpenJournal(dir, 256)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Build the components
+	publisher := NewSimplePublishNode(32)
+	consumer1 := NewJournaler(j, &int64Codec{ring: ring})
+	consumer2 := NewSimpleConsumeNode()
+	barrier := NewConsumeBarrier()
+	consumer3 := NewSimpleConsumeNode()
+
+	// Link the committed counter dependencies together.
+	consumer1.SetDependency(publisher.Committed())
+	consumer2.SetDependency(publisher.Committed())
+	barrier.AddDependency(consumer1.Committed())
+	barrier.AddDependency(consumer2.Committed())
+	consumer3.SetDependency(barrier.Committed())
+	publisher.SetDependency(consumer3.Committed())
+
+	done := make(chan bool)
+	journaled := make(chan error)
+
+	go func() {
+		barrier.Run()
+	}()
+
+	go func() {
+		journaled <- consumer1.Run()
+	}()
+
+	go func() {
+		for i := int64(0); i < 200; i++ {
+			consumer2.Reserve()
+			consumer2.Commit()
+		}
+	}()
+
+	go func() {
+		for i := int64(0); i < 200; i++ {
+			consumer3.Reserve()
+			consumer3.Commit()
+		}
+		done <- true
+	}()
+
+	for i := int64(0); i < 200; i++ {
+		index := publisher.Reserve()
+		ring[*index&31] = i * 10
+		publisher.Commit()
+	}
+
+	<-done
+	barrier.Stop()
+	consumer1.Stop()
+	if err := <-journaled; err != nil {
+		t.Fatalf("Unexpected journal error: %s", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	segments, _ := JournalSegments(dir)
+	if len(segments) < 2 {
+		t.Errorf("Expected the journal to rotate, got %d segments.", len(segments))
+	}
+
+	next, err := ReadJournal(dir, 50, func(seq int64, data []byte) error {
+		if v := int64(binary.LittleEndian.Uint64(data)); v != seq*10 {
+			t.Errorf("Sequence %d: expected %d, got %d.", seq, seq*10, v)
+		}
+		return nil
+	})
+	if next != 200 || err != nil {
+		t.Errorf("Expected to read up to 200, got %d %v.", next, err)
+	}
+
+	// Rebuild the ring from the journal.
+	replayed := make([]int64, 32)
+	rebuild := NewSimplePublishNode(32)
+	app := NewSimpleConsumeNode()
+	rebuild.SetDependency(app.Committed())
+	app.SetDependency(rebuild.Committed())
+
+	go func() {
+		for i := int64(0); i < 200; i++ {
+			index := app.Reserve()
+			if v := replayed[*index&31]; v != i*10 {
+				t.Errorf("Replay %d: expected %d, got %d.", i, i*10, v)
+			}
+			app.Commit()
+		}
+		done <- true
+	}()
+
+	next, err = Replay(dir, 0, &int64Codec{ring: replayed}, rebuild)
+	if next != 200 || err != nil {
+		t.Errorf("Expected to replay up to 200, got %d %v.", next, err)
+	}
+	<-done
+}
+
+// A crash part way through a record leaves a torn tail that is dropped on open.
+func TestJournalTornTail(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir, 1024)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for seq := int64(5); seq < 10; seq++ {
+		if err := j.Append(seq, []byte("event")); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	if err := j.Append(11, []byte("event")); err != ErrJournalSequence {
+		t.Errorf("Expected ErrJournalSequence, got %v.", err)
+	}
+	j.Close()
+
+	f, _ := os.OpenFile(segmentPath(dir, 5), os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{9, 0, 0, 0, 1, 2})
+	f.Close()
+
+	if next, err := ReadJournal(dir, 0, func(int64, []byte) error { return nil }); next != 10 || err != nil {
+		t.Errorf("Expected to read up to 10, got %d %v.", next, err)
+	}
+
+	j, err = OpenJournal(dir, 1024)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if j.Next() != 10 {
+		t.Errorf("Expected to resume at 10, got %d.", j.Next())
+	}
+	if err := j.Append(10, []byte("event")); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	j.Close()
+
+	if next, err := ReadJournal(dir, 0, func(int64, []byte) error { return nil }); next != 11 || err != nil {
+		t.Errorf("Expected to read up to 11, got %d %v.", next, err)
+	}
+}
+
+func TestJournalVerifyTruncate(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir, 128)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for seq := int64(0); seq < 40; seq++ {
+		if err := j.Append(seq, []byte("event")); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	j.Close()
+
+	if next, err := VerifyJournal(dir); next != 40 || err != nil {
+		t.Errorf("Expected a good journal up to 40, got %d %v.", next, err)
+	}
+
+	if err := TruncateJournal(dir, 25); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if next, err := VerifyJournal(dir); next != 25 || err != nil {
+		t.Errorf("Expected a good journal up to 25, got %d %v.", next, err)
+	}
+
+	// Lose a middle segment.
+	segments, _ := JournalSegments(dir)
+	os.Remove(segments[1].Path)
+	if _, err := VerifyJournal(dir); !errors.Is(err, ErrJournalSequence) {
+		t.Errorf("Expected a sequence gap, got %v.", err)
+	}
+
+	// Damage a record.
+	f, _ := os.OpenFile(segments[0].Path, os.O_WRONLY, 0644)
+	f.WriteAt([]byte{0xff}, journalHeaderLength+journalRecordHeader)
+	f.Close()
+	if next, err := VerifyJournal(dir); next != 0 || !errors.Is(err, ErrJournalCorrupt) {
+		t.Errorf("Expected a corrupt record at 0, got %d %v.", next, err)
+	}
+}
+
+func init() {
+	RegisterJournalDecoder("test-int64", func(seq int64, data []byte) (interface{}, error) {
+		return int64(binary.LittleEndian.Uint64(data)), nil
+	})
+}
+
+func TestJournalDecoders(t *testing.T) {
+	d, ok := LookupJournalDecoder("test-int64")
+	if !ok {
+		t.Fatalf("Expected the decoder to be registered.")
+	}
+	if v, _ := d(0, []byte{7, 0, 0, 0, 0, 0, 0, 0}); v != int64(7) {
+		t.Errorf("Expected 7, got %v.", v)
+	}
+	if _, ok := LookupJournalDecoder("missing"); ok {
+		t.Errorf("Expected no decoder named missing.")
+	}
+}
+
+// Replay refuses to put an event in the cell of another sequence, whether the ring is not at the
+// starting sequence or a segment is missing.
+func TestJournalReplayGap(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir, 64)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	codec := &int64Codec{ring: make([]int64, 64)}
+	for seq := int64(0); seq < 30; seq++ {
+		codec.ring[seq] = seq * 10
+		data, _ := codec.Encode(nil, seq)
+		if err := j.Append(seq, data); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	segments, _ := JournalSegments(dir)
+	if len(segments) < 3 {
+		t.Fatalf("Expected the journal to rotate, got %d segments.", len(segments))
+	}
+
+	// replay replays from into a fresh ring, with a consumer that is never run.
+	replay := func(from int64, seq int64) (int64, error) {
+		publisher := NewSimplePublishNode(64)
+		consumer := NewSimpleConsumeNode()
+		publisher.SetDependency(consumer.Committed())
+		publisher.SetSequence(seq)
+		consumer.SetSequence(seq)
+		return Replay(dir, from, &int64Codec{ring: make([]int64, 64)}, publisher)
+	}
+
+	if next, err := replay(5, 5); next != 30 || err != nil {
+		t.Errorf("Expected to replay up to 30, got %d %v.", next, err)
+	}
+	if _, err := replay(5, 0); !errors.Is(err, ErrJournalSequence) {
+		t.Errorf("Expected a ring not at the start to be refused, got %v.", err)
+	}
+
+	// Lose a segment from the middle.
+	if err := os.Remove(segments[1].Path); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, err := replay(0, 0); !errors.Is(err, ErrJournalSequence) {
+		t.Errorf("Expected the gap at %d to be refused, got %v.", segments[1].First, err)
+	}
+}
@@ -0,0 +1,107 @@
+package ringo
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// journaler is a consumer that records every event it reads from the ring into a journal.
+// It works through whatever its dependency has made available as a batch: each event is encoded with
+// the codec and appended, then the journal is synced once at the end of the batch. The committed
+// counter only moves past a batch once it is on disk, so consumers that depend on the journaler only
+// see events that would survive a crash.
+// If a durableBarrier is attached, the journaler only hands each batch to the operating system and
+// its committed counter tracks events written. The barrier decides when to sync.
+type journaler struct {
+	cachepad1  [8]int64
+	committed  int64 // Read counter and index to the next ring buffer entry.
+	cachepad2  [7]int64
+	dependency *int64   // The committed register that this object is dependent on to finish.
+	journal    *journal // Where the events are recorded.
+	codec      Codec    // Converts events in the ring into journal records.
+	buffer     []byte   // Reused for encoding.
+	sync       bool     // Sync at the end of each batch, unless a durableBarrier does it instead.
+	running    bool     // Is this journaler chasing the dependency in a Run() loop?
+}
+
+// NewJournaler is a factory function for returning a new instance of a journaler.
+func NewJournaler(j *journal, c Codec) *journaler {
+	return &journaler{
+		journal: j,
+		codec:   c,
+		sync:    true,
+	}
+}
+
+// Run continually journals the events made available by the dependency until Stop is called or an
+// error occurs. The error is returned and nothing further is committed.
+func (j *journaler) Run() error {
+	j.running = true
+	for j.running {
+		available := atomic.LoadInt64(j.dependency)
+		if available == j.committed {
+			runtime.Gosched()
+			continue
+		}
+		for seq := j.committed; seq < available; seq++ {
+			if err := j.append(seq); err != nil {
+				j.running = false
+				return err
+			}
+		}
+		if err := j.endBatch(); err != nil {
+			j.running = false
+			return err
+		}
+		atomic.StoreInt64(&j.committed, available)
+	}
+	return nil
+}
+
+// Stop breaks the loop cycle of the run.
+func (j *journaler) Stop() {
+	j.running = false
+}
+
+// Running returns the state of the running flag.
+func (j *journaler) Running() bool {
+	return j.running
+}
+
+// Committed returns a pointer to the committed counter.
+func (j *journaler) Committed() *int64 {
+	return &j.committed
+}
+
+// SetDependency sets the dependent commit counter of this node.
+func (j *journaler) SetDependency(d *int64) {
+	j.dependency = d
+}
+
+// append encodes the event for seq and adds it to the journal.
+func (j *journaler) append(seq int64) error {
+	var err error
+	if j.buffer, err = j.codec.Encode(j.buffer[:0], seq); err != nil {
+		return err
+	}
+	return j.journal.Append(seq, j.buffer)
+}
+
+// endBatch syncs the journal, or only flushes it if a durableBarrier syncs instead.
+func (j *journaler) endBatch() error {
+	if j.sync {
+		return j.journal.Sync()
+	}
+	return j.journal.Flush()
+}
+
+// Sequence returns the index of the next entry to be journaled.
+func (j *journaler) Sequence() int64 {
+	return atomic.LoadInt64(&j.committed)
+}
+
+// SetSequence positions the journaler so the next entry journaled is at seq, normally the Next of
+// its journal. It must be called before the journaler is in use.
+func (j *journaler) SetSequence(seq int64) {
+	j.committed = seq
+}
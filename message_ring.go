@@ -0,0 +1,202 @@
+package ringo
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	msgHeaderLength int64 = 8  // Length and type words that prefix every record.
+	msgAlignment    int64 = 8  // Records start on this boundary so headers can be updated atomically.
+	msgTypeData     int32 = 1  // Record carries a message.
+	msgTypePadding  int32 = -1 // Record fills the space up to the end of the ring and is skipped.
+)
+
+// ErrTooLarge is returned when a message can never fit into a message ring.
+var ErrTooLarge = errors.New("ringo: message too large for ring")
+
+// messageRing is a ring buffer of bytes that carries variable length messages.
+// Publishers claim a length prefixed record sized to their message. A record that would straddle the
+// physical end of the ring is preceded by a padding record, so every message is contiguous and can be
+// read in place. In multi mode any number of go routines may publish, competing for the tail in the same
+// way as multiPublishNode. Only one go routine may consume.
+type messageRing struct {
+	cachepad1 [8]int64
+	tail      int64 // Byte position of the next record to be claimed.
+	cachepad2 [7]int64
+	headCache int64 // Publisher copy of head so the consumers cacheline is touched only when needed.
+	cachepad3 [7]int64
+	head      int64 // Byte position of the next record to be read.
+	cachepad4 [7]int64
+	buffer    []byte // Record storage.
+	capacity  int64  // Size of the buffer in bytes.
+	mask      int64  // Used in place of modulo for index calculations.
+	multi     bool   // Are multiple publishers competing for the tail?
+	pending   int64  // Aligned length of the record last returned by Read.
+}
+
+// NewMessageRing is a factory function for returning a new instance of a messageRing.
+// size is the number of bytes in the ring and must be a power of two. Set multi if more than one
+// go routine will be publishing.
+func NewMessageRing(size int64, multi bool) *messageRing {
+	// The allocator returns memory aligned to at least 8 bytes for buffers of this size,
+	// which keeps every record header on a boundary suitable for atomic access.
+	return &messageRing{
+		buffer:   make([]byte, size),
+		capacity: size,
+		mask:     size - 1,
+		multi:    multi,
+	}
+}
+
+// MaxMessageLength returns the largest message that may be published to the ring.
+func (r *messageRing) MaxMessageLength() int {
+	return int(r.capacity/8 - msgHeaderLength)
+}
+
+// Reserve claims a record for a message of length bytes, waiting until there is room in the ring.
+// It returns the index of the record, which must be handed to Commit, and the slice the message is
+// to be written into.
+func (r *messageRing) Reserve(length int) (int64, []byte, error) {
+	if length < 0 || length > r.MaxMessageLength() {
+		return 0, nil, ErrTooLarge
+	}
+	recordLength := int64(length) + msgHeaderLength
+	required := alignRecord(recordLength)
+
+	var tail, tailIndex, padding int64
+	for {
+		tail = atomic.LoadInt64(&r.tail)
+		tailIndex = tail & r.mask
+		padding = 0
+
+		// A record never wraps. If it doesn't fit before the end, pad out the rest of the ring.
+		if toEnd := r.capacity - tailIndex; required > toEnd {
+			padding = toEnd
+		}
+
+		// Wait for the consumer to free enough room.
+		if tail+padding+required-atomic.LoadInt64(&r.headCache) > r.capacity {
+			head := atomic.LoadInt64(&r.head)
+			if tail+padding+required-head > r.capacity {
+				runtime.Gosched()
+				continue
+			}
+			atomic.StoreInt64(&r.headCache, head)
+		}
+
+		if !r.multi {
+			atomic.StoreInt64(&r.tail, tail+padding+required)
+			break
+		}
+		// Try and store the new tail. If it was changed by another routine, loop and try again.
+		if atomic.CompareAndSwapInt64(&r.tail, tail, tail+padding+required) {
+			break
+		}
+	}
+
+	if padding != 0 {
+		atomic.StoreInt32(r.word(tailIndex+4), msgTypePadding)
+		atomic.StoreInt32(r.word(tailIndex), int32(padding))
+		tailIndex = 0
+	}
+
+	// A negative length marks the record as claimed but not yet committed.
+	atomic.StoreInt32(r.word(tailIndex+4), msgTypeData)
+	atomic.StoreInt32(r.word(tailIndex), int32(-recordLength))
+	return tailIndex, r.buffer[tailIndex+msgHeaderLength : tailIndex+recordLength], nil
+}
+
+// Commit marks the record at index as complete and visible to the consumer.
+func (r *messageRing) Commit(index int64) {
+	length := r.word(index)
+	atomic.StoreInt32(length, -atomic.LoadInt32(length))
+}
+
+// Write is a convenience function that reserves a record, copies msg into it and commits it.
+func (r *messageRing) Write(msg []byte) error {
+	index, buf, err := r.Reserve(len(msg))
+	if err != nil {
+		return err
+	}
+	copy(buf, msg)
+	r.Commit(index)
+	return nil
+}
+
+// Read waits for the next committed message and returns it. The slice refers directly to the
+// ring and is only valid until Release is called.
+func (r *messageRing) Read() []byte {
+	for {
+		index := r.head & r.mask
+		length := int64(atomic.LoadInt32(r.word(index)))
+		if length <= 0 {
+			runtime.Gosched()
+			continue
+		}
+
+		if atomic.LoadInt32(r.word(index+4)) == msgTypePadding {
+			r.release(alignRecord(length))
+			continue
+		}
+		r.pending = alignRecord(length)
+		return r.buffer[index+msgHeaderLength : index+length]
+	}
+}
+
+// Release hands the space of the message last returned by Read back to the publishers.
+func (r *messageRing) Release() {
+	r.release(r.pending)
+	r.pending = 0
+}
+
+// ReadBatch waits for committed records and returns the raw bytes of every record available,
+// padding included, as at most two slices. The second slice is only used when the records wrap
+// around the physical end of the ring. The slices refer directly to the ring, so they can be handed
+// to vectored writes such as net.Buffers, and are only valid until ReleaseBatch is called.
+func (r *messageRing) ReadBatch() ([]byte, []byte) {
+	var length int64
+	for length == 0 {
+		for length < r.capacity {
+			recordLength := int64(atomic.LoadInt32(r.word((r.head + length) & r.mask)))
+			if recordLength <= 0 {
+				break
+			}
+			length += alignRecord(recordLength)
+		}
+		if length == 0 {
+			runtime.Gosched()
+		}
+	}
+	return ByteSegments(r.buffer, r.head, r.head+length)
+}
+
+// ReleaseBatch hands length bytes of records returned by ReadBatch back to the publishers.
+func (r *messageRing) ReleaseBatch(length int64) {
+	r.release(length)
+}
+
+// release zeroes a consumed region so stale headers are never mistaken for new records,
+// then advances the head past it.
+func (r *messageRing) release(length int64) {
+	head, tail := ByteSegments(r.buffer, r.head, r.head+length)
+	for i := range head {
+		head[i] = 0
+	}
+	for i := range tail {
+		tail[i] = 0
+	}
+	atomic.StoreInt64(&r.head, r.head+length)
+}
+
+// word returns a pointer to the 32 bit header word at index.
+func (r *messageRing) word(index int64) *int32 {
+	return (*int32)(unsafe.Pointer(&r.buffer[index]))
+}
+
+// alignRecord rounds a record length up to the next record boundary.
+func alignRecord(length int64) int64 {
+	return (length + msgAlignment - 1) &^ (msgAlignment - 1)
+}
@@ -0,0 +1,116 @@
+package ringo
+
+import (
+	"encoding/binary"
+	"runtime"
+	"testing"
+)
+
+// A simple message queue: Publisher <==> Consumer with messages of varying length that wrap the ring.
+func TestMessageRingSimple(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := NewMessageRing(1024, false)
+	done := make(chan bool)
+
+	go func() {
+		for i := 0; i < 4096; i++ {
+			msg := ring.Read()
+			if len(msg) != 8+i%100 {
+				t.Errorf("Message %d has length %d.", i, len(msg))
+			}
+			if n := binary.LittleEndian.Uint64(msg); n != uint64(i) {
+				t.Errorf("Expected message %d, got %d.", i, n)
+			}
+			ring.Release()
+		}
+		close(done)
+	}()
+
+	for i := 0; i < 4096; i++ {
+		index, buf, err := ring.Reserve(8 + i%100)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		binary.LittleEndian.PutUint64(buf, uint64(i))
+		ring.Commit(index)
+	}
+	<-done
+}
+
+// A Multi Publisher message queue: n-Publishers <==> 1 Consumer
+func TestMessageRingMulti(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := NewMessageRing(1024, true)
+	done := make(chan bool)
+
+	go func() {
+		next := make([]uint32, 3)
+		for i := 0; i < 3*2048; i++ {
+			msg := ring.Read()
+			id, n := binary.LittleEndian.Uint32(msg), binary.LittleEndian.Uint32(msg[4:])
+			if n != next[id] {
+				t.Errorf("Publisher %d: expected message %d, got %d.", id, next[id], n)
+			}
+			next[id] = n + 1
+			ring.Release()
+		}
+		close(done)
+	}()
+
+	for p := 0; p < 3; p++ {
+		go func(id uint32) {
+			msg := make([]byte, 8+id*20)
+			binary.LittleEndian.PutUint32(msg, id)
+			for i := uint32(0); i < 2048; i++ {
+				binary.LittleEndian.PutUint32(msg[4:], i)
+				if err := ring.Write(msg); err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+			}
+		}(uint32(p))
+	}
+	<-done
+}
+
+func TestMessageRingTooLarge(t *testing.T) {
+	ring := NewMessageRing(1024, false)
+	if _, _, err := ring.Reserve(ring.MaxMessageLength() + 1); err != ErrTooLarge {
+		t.Errorf("Expected ErrTooLarge, got %v.", err)
+	}
+	if err := ring.Write(make([]byte, ring.MaxMessageLength())); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func BenchmarkMessageRing(b *testing.B) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+	interations := b.N
+
+	ring := NewMessageRing(PT4Meg, false)
+	msg := make([]byte, 64)
+	done := make(chan bool)
+
+	go func() {
+		for i := 0; i < interations; i++ {
+			ring.Read()
+			ring.Release()
+		}
+		close(done)
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < interations; i++ {
+		ring.Write(msg)
+	}
+	b.StopTimer()
+	<-done
+}
@@ -18,6 +18,9 @@ type multiNode struct {
 	barrier    int64    // Used to find the next dependent cell to check.
 	mask       int64    // Used in place of modulo for index calculations.
 	shift      uint8    // Used to mark a cell with which rotation processed.
+	publishPolicy
+	evictable
+	nodeDebug
 }
 
 // NewMultiNode is a factory function that returns a single multiNode instance.
@@ -50,11 +53,20 @@ func (m *multiNode) Reserve() int64 {
 		previous = atomic.LoadInt64(&m.cursor) // Get the previous pointer.
 		next = previous + 1                    // Increment to get next index.
 		gate = next - m.barrier                // Calculate the dependency marker.
+		if m.evictor != nil && m.skip(previous) {
+			continue
+		}
 
 		// Validate that the dependency has completed processing on this cell and it's free for use.
-		// If not, wait until it is.
-		for m.dependency[next&m.mask] != int32(gate>>m.shift) {
+		// If not, wait until it is. A node following an evicting publisher gives up waiting if the
+		// cell is lost, as the dependency will never stamp it with the rotation it expects.
+		waiting := m.dependency[next&m.mask] != int32(gate>>m.shift)
+		for waiting && !m.Evicted(next) {
 			time.Sleep(time.Microsecond)
+			waiting = m.dependency[next&m.mask] != int32(gate>>m.shift)
+		}
+		if waiting {
+			continue
 		}
 
 		// Try and update the new sequence number. If successful, then return,
@@ -65,9 +77,93 @@ func (m *multiNode) Reserve() int64 {
 	}
 }
 
+// pollBatch claims every cell available after the cursor without waiting, in competition with the
+// other go routines using the node, and returns them from up to but not including to. They are equal
+// if there are none.
+func (m *multiNode) pollBatch() (int64, int64) {
+	for {
+		previous := atomic.LoadInt64(&m.cursor)
+		if m.evictor != nil && m.skip(previous) {
+			continue
+		}
+		from := previous + 1
+		to := from
+		for to-from < m.mask+1 && m.dependency[to&m.mask] == int32((to-m.barrier)>>m.shift) {
+			to++
+		}
+		if to == from || atomic.CompareAndSwapInt64(&m.cursor, previous, to-1) {
+			return from, to
+		}
+	}
+}
+
+// skip claims the cells after previous that have been lost to an eviction, and stamps them as
+// completed so the nodes that depend on this one are not held up; as they follow the evictor too,
+// they skip them. It returns true if the cursor has moved and should be read again, whether this go
+// routine or another claimed the cells.
+func (m *multiNode) skip(previous int64) bool {
+	next, oldest := previous+1, m.evictor.Oldest()
+	if next >= oldest {
+		return false
+	}
+	if !atomic.CompareAndSwapInt64(&m.cursor, previous, oldest-1) {
+		return true
+	}
+	atomic.AddInt64(&m.missed, oldest-next)
+	from := next
+	if oldest-from > m.mask+1 {
+		from = oldest - (m.mask + 1) // Only the last rotation of each cell needs stamping.
+	}
+	for index := from; index < oldest; index++ {
+		m.committed[index&m.mask] = int32(index >> m.shift)
+	}
+	return true
+}
+
+// TryReserve is used by a leader to allocate a cell in the ring buffer, applying its policy if the
+// buffer is full. ErrFull or ErrDropped is returned if the policy refuses the item. If the policy
+// evicts, the oldest unconsumed event is given up.
+func (m *multiNode) TryReserve() (int64, error) {
+	var previous, next int64
+
+	for {
+		previous = atomic.LoadInt64(&m.cursor) // Get the previous pointer.
+		next = previous + 1                    // Increment to get next index.
+		evicting := false
+		if m.dependency[next&m.mask] != int32((next-m.barrier)>>m.shift) {
+			wait, err := m.full()
+			if err != nil {
+				return 0, err
+			}
+			if wait {
+				return m.Reserve(), nil
+			}
+			evicting = true
+		}
+
+		// Try and update the new sequence number. If successful, then return,
+		// otherwise loop and try this process again (some other caller got the index first).
+		if atomic.CompareAndSwapInt64(&m.cursor, previous, next) {
+			if evicting {
+				m.evict(next, m.barrier)
+			}
+			return next, nil
+		}
+	}
+}
+
 // Commit marks a cell in the ring status as completed. Any other node that is relying on this
 // node to complete it's work can now know it may proceed to use it's corresponding cell.
 func (m *multiNode) Commit(index int64) {
+	if debugging {
+		if cursor := atomic.LoadInt64(&m.cursor); index > cursor {
+			m.violated("Commit of %d without a Reserve, only %d reserved", index, cursor)
+		}
+		if m.barrier == 0 || index >= m.Oldest()+m.barrier {
+			m.gated(m.dependency, index, m.barrier, m.mask, m.shift)
+		}
+		m.stamping(m.committed, index, m.mask, m.shift)
+	}
 	m.committed[index&m.mask] = int32(index >> m.shift)
 }
 
@@ -80,3 +176,30 @@ func (m *multiNode) Committed() []int32 {
 func (m *multiNode) SetDependency(dep []int32) {
 	m.dependency = dep
 }
+
+// Sequence returns the index of the lowest cell not yet committed. Callers may commit out of order,
+// so this scans the whole commit ring and is meant for occasional use such as checkpoints.
+func (m *multiNode) Sequence() int64 {
+	cursor := atomic.LoadInt64(&m.cursor)
+	next := cursor + 1
+	for index := cursor; index > cursor-int64(len(m.committed)); index-- {
+		if m.committed[index&m.mask] != int32(index>>m.shift) {
+			next = index
+		}
+	}
+	return next
+}
+
+// Occupancy returns how many cells a leader has published that its dependency has not finished.
+func (m *multiNode) Occupancy() int64 {
+	next := m.Sequence()
+	return next - ringProgress(m.dependency, next-m.barrier, next, m.shift)
+}
+
+// SetSequence positions the node so the next cell reserved is at seq, and stamps its commit ring as
+// if every cell below seq had been committed. Nodes that depend on each other must be positioned at
+// the same sequence. It must be called before the node is in use.
+func (m *multiNode) SetSequence(seq int64) {
+	m.cursor = seq - 1
+	stampRing(m.committed, seq, m.shift)
+}
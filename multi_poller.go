@@ -0,0 +1,61 @@
+package ringo
+
+// multiPoller lets a caller that owns its loop consume from a multiNode shared with other go routines.
+// Each Poll claims whatever cells are available without waiting, in competition with the other
+// pollers and Reserve calls on the node, and hands them to its handler. Give each go routine a poller
+// of its own; the node is wired into the topology as usual.
+// A cell claimed by one poller cannot be handed back to the others, so if its handler fails, that cell
+// and the rest of the batch stay with the poller and are handed over again by its next Poll.
+type multiPoller struct {
+	node      *multiNode // Tracks the cells processed.
+	publisher sequencer  // The publisher, used to tell gating from idle.
+	held      int64      // The first cell claimed but not yet committed.
+	end       int64      // The cell after the last one claimed.
+}
+
+// NewMultiPoller is a factory function for returning a new instance of a multiPoller.
+// p is the publisher of the ring. If the node depends on another stage rather than the publisher,
+// it lets Poll report PollGating instead of PollIdle while cells are waiting on that stage.
+func NewMultiPoller(n *multiNode, p sequencer) *multiPoller {
+	return &multiPoller{
+		node:      n,
+		publisher: p,
+	}
+}
+
+// Poll hands the cells left over from a failed Poll, or else every cell it can claim now, to h and
+// commits them. It never waits. If h returns an error, it is returned with every cell before the
+// failed one committed.
+func (m *multiPoller) Poll(h Handler) (PollState, error) {
+	from, to := m.held, m.end
+	if from == to {
+		from, to = m.node.pollBatch()
+	}
+	if from == to {
+		if m.publisher.Sequence() > from {
+			return PollGating, nil
+		}
+		return PollIdle, nil
+	}
+	m.end = to
+	return PollProcessing, poll(h, from, to, m.commit)
+}
+
+// commit marks the cells processed as completed, from up to but not including to, and keeps any
+// cells of the batch left over for the next Poll.
+func (m *multiPoller) commit(from int64, to int64) {
+	for index := from; index < to; index++ {
+		m.node.Commit(index)
+	}
+	m.held = to
+}
+
+// Node returns the node this poller drives.
+func (m *multiPoller) Node() *multiNode {
+	return m.node
+}
+
+// Sequence returns the index of the lowest cell not yet committed by any user of the node.
+func (m *multiPoller) Sequence() int64 {
+	return m.node.Sequence()
+}
@@ -8,12 +8,15 @@ import (
 // multiPublishNode is shared by multiple thread/go routines for publishing events to the ring buffer.
 // Because multiple routines must compete for next index, a single lock is maintained.
 type multiPublishNode struct {
-	sequence   int64 // Write counter and index to the next ring buffer entry.
-	cachepad1  [7]int64
-	committed  int64 // Keeps track of the number of written events to the ring.
-	cachepad2  [7]int64
-	dependency *int64 // The consumer's committed register we are dependent to finish before proceeding.
-	buffSize   int64  // Size of the ring buffer.
+	sequence  int64 // Write counter and index to the next ring buffer entry.
+	cachepad1 [7]int64
+	committed int64 // Keeps track of the number of written events to the ring.
+	cachepad2 [7]int64
+	gate      int64     // Lowest dependency when last read, cached to save reading them all.
+	gating    gatingSet // The consumers' committed registers we are dependent to finish before proceeding.
+	buffSize  int64     // Size of the ring buffer.
+	publishPolicy
+	nodeDebug
 }
 
 // Factory function for returning a new instance of a multiPublishNode.
@@ -28,7 +31,7 @@ func (m *multiPublishNode) Reserve() int64 {
 	for {
 		previous := m.sequence // Get the previous counter.
 		// Wait for room in the buffer if it is full.
-		for previous-*m.dependency == m.buffSize {
+		for m.wrapped(previous) {
 			runtime.Gosched()
 		}
 		// Try and store the new increment. If it was changed by another routine, loop and try again.
@@ -38,17 +41,108 @@ func (m *multiPublishNode) Reserve() int64 {
 	}
 }
 
+// TryReserve returns the next new index, applying the policy if the buffer is full.
+// ErrFull or ErrDropped is returned if the policy refuses the item. If the policy evicts, the oldest
+// unconsumed event is given up.
+func (m *multiPublishNode) TryReserve() (int64, error) {
+	for {
+		previous := atomic.LoadInt64(&m.sequence) // Get the previous counter.
+		evicting := false
+		if m.wrapped(previous) {
+			wait, err := m.full()
+			if err != nil {
+				return 0, err
+			}
+			if wait {
+				return m.Reserve(), nil
+			}
+			evicting = true
+		}
+		// Try and store the new increment. If it was changed by another routine, loop and try again.
+		if atomic.CompareAndSwapInt64(&m.sequence, previous, previous+1) {
+			if evicting {
+				m.evict(previous, m.buffSize)
+			}
+			return previous, nil
+		}
+	}
+}
+
 // Commit increments the commit register to indicate an entry has been stored.
 func (m *multiPublishNode) Commit() {
+	if debugging {
+		committed := atomic.LoadInt64(&m.committed)
+		if sequence := atomic.LoadInt64(&m.sequence); committed >= sequence {
+			m.violated("Commit of %d without a Reserve, only %d reserved", committed, sequence)
+		}
+		if gate := m.gating.lowest(committed); committed-gate >= m.buffSize &&
+			committed >= m.Oldest()+m.buffSize {
+			m.violated("Commit of %d overwrites %d before its slowest dependency at %d read it",
+				committed, committed-m.buffSize, gate)
+		}
+	}
 	m.committed++
 }
 
+// Occupancy returns how many events have been published that the slowest dependency has not finished.
+func (m *multiPublishNode) Occupancy() int64 {
+	committed := atomic.LoadInt64(&m.committed)
+	return committed - m.gating.lowest(committed)
+}
+
 // Committed returns a pointer to the committed counter.
 func (m *multiPublishNode) Committed() *int64 {
 	return &m.committed
 }
 
+// wrapped reports whether the entry at index would overwrite one a dependency has not finished with.
+// The dependencies are only read again when the cached gate says the buffer is full.
+func (m *multiPublishNode) wrapped(index int64) bool {
+	if index-atomic.LoadInt64(&m.gate) < m.buffSize {
+		return false
+	}
+	gate := m.gating.lowest(index)
+	atomic.StoreInt64(&m.gate, gate)
+	return index-gate >= m.buffSize
+}
+
 // SetDependency set the commtted counter that must complete work before we can proceed.
+// It replaces any dependencies added.
 func (m *multiPublishNode) SetDependency(d *int64) {
-	m.dependency = d
+	m.gating.set(d)
+}
+
+// AddDependency adds a committed counter this node must not overtake. It may be called while the
+// node is publishing. Use Attach to add a new consumer at the current position.
+func (m *multiPublishNode) AddDependency(d *int64) {
+	m.gating.add(d)
+}
+
+// RemoveDependency removes a committed counter added with SetDependency or AddDependency, so a
+// consumer can be detached while the node is publishing. It returns false if d was not found.
+func (m *multiPublishNode) RemoveDependency(d *int64) bool {
+	return m.gating.remove(d)
+}
+
+// Attach wires up a new consumer, such as an audit tap, to read from the next entry to be published
+// and adds it as a dependency. It may be called while the node is publishing, from any go routine,
+// as long as the consumer is not yet in use.
+func (m *multiPublishNode) Attach(c *simpleConsumeNode) {
+	c.SetDependency(&m.committed)
+	atomic.StoreInt64(&c.committed, atomic.LoadInt64(&m.committed))
+	m.AddDependency(&c.committed)
+	// The publishers may have moved on before they saw the new dependency, but can no longer pass it.
+	atomic.StoreInt64(&c.committed, atomic.LoadInt64(&m.committed))
+}
+
+// Sequence returns the count of entries published, which is also the index of the next entry.
+func (m *multiPublishNode) Sequence() int64 {
+	return atomic.LoadInt64(&m.committed)
+}
+
+// SetSequence positions the node so the next entry published is at seq.
+// It must be called before the node is in use.
+func (m *multiPublishNode) SetSequence(seq int64) {
+	m.sequence = seq
+	m.committed = seq
 }
@@ -2,6 +2,8 @@ package ringo
 
 import (
 	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,26 +12,33 @@ import (
 // to complete their work on a cell in a ring buffer. A Barrier would watch the first two Consumers
 // and record when both complete the same cell. The third Consumer would check the barrier to see if it
 // can also proceed to read the next cell.
+// A quorum barrier instead marks a cell once at least quorum of the dependencies complete it, such as
+// any one of several replicas. Barriers of either kind can depend on each other.
+// A quorum barrier is only for downstream stages. The publisher must stay gated on every replica,
+// directly or through an all-of barrier, or it laps the slowest one and overwrites cells it has yet
+// to read.
 type nodeBarrier struct {
-	cachepad1    [8]int64  // Cacheline padding.
-	cursor       int64     // Tracks the cell id being processed in the ring.
-	cachepad2    [7]int64  // Cacheline padding.
-	committed    []int32   // Tracks this nodes progress.
-	dependencies [][]int32 // Measures multiple dependent node progress.
-	mask         int64     // Used in place of modulo for index calculations.
-	shift        uint8     // Used to mark a cell with which rotation processed.
-	running      bool      // Is this Barrier chasing the dependencies in a Run() loop?
+	cachepad1    [8]int64     // Cacheline padding.
+	cursor       int64        // Tracks the cell id being processed in the ring.
+	cachepad2    [7]int64     // Cacheline padding.
+	committed    []int32      // Tracks this nodes progress.
+	mu           sync.Mutex   // Serializes changes to the dependencies.
+	dependencies atomic.Value // Measures multiple dependent node progress, as a [][]int32.
+	mask         int64        // Used in place of modulo for index calculations.
+	shift        uint8        // Used to mark a cell with which rotation processed.
+	quorum       int          // How many dependencies must complete a cell. Zero means all of them.
+	running      bool         // Is this Barrier chasing the dependencies in a Run() loop?
 }
 
 // Factory function for returning a new instance of a nodeBarrier.
 func NewNodeBarrier(size int64) *nodeBarrier {
 	n := &nodeBarrier{
-		cursor:       int64(initSeqValue),
-		committed:    make([]int32, size),
-		dependencies: make([][]int32, 0),
-		mask:         size - 1,
-		shift:        uint8(math.Log2(float64(size))),
+		cursor:    int64(initSeqValue),
+		committed: make([]int32, size),
+		mask:      size - 1,
+		shift:     uint8(math.Log2(float64(size))),
 	}
+	n.dependencies.Store([][]int32{})
 
 	for i := int64(0); i < size; i++ {
 		n.committed[i] = int32(initSeqValue)
@@ -37,6 +46,20 @@ func NewNodeBarrier(size int64) *nodeBarrier {
 	return n
 }
 
+// NewQuorumNodeBarrier is a factory function for returning a new instance of a nodeBarrier that
+// marks a cell once quorum of its dependencies have completed it.
+func NewQuorumNodeBarrier(size int64, quorum int) *nodeBarrier {
+	n := NewNodeBarrier(size)
+	n.quorum = quorum
+	return n
+}
+
+// NewAnyOfNodeBarrier is a factory function for returning a new instance of a nodeBarrier that
+// marks a cell once any one of its dependencies has completed it.
+func NewAnyOfNodeBarrier(size int64) *nodeBarrier {
+	return NewQuorumNodeBarrier(size, 1)
+}
+
 // Run continually updates the commt status by chasing the multiple dependencies.
 func (n *nodeBarrier) Run() {
 	n.running = true
@@ -44,10 +67,8 @@ func (n *nodeBarrier) Run() {
 		n.cursor++ // Increment pointer.
 
 		// Wait for all dependencies to complete.
-		for _, dep := range n.dependencies {
-			for dep[n.cursor&n.mask] != int32(n.cursor>>n.shift) {
-				time.Sleep(time.Microsecond)
-			}
+		for !n.ready(n.cursor) {
+			time.Sleep(time.Microsecond)
 		}
 
 		// Mark and continue.
@@ -55,6 +76,37 @@ func (n *nodeBarrier) Run() {
 	}
 }
 
+// pollBatch returns every cell the barrier can mark without waiting, from up to but not including
+// to. They are equal if there are none.
+func (n *nodeBarrier) pollBatch() (int64, int64) {
+	from := n.cursor + 1
+	to := from
+	for to-from < n.mask+1 && n.ready(to) {
+		to++
+	}
+	return from, to
+}
+
+// ready reports whether enough dependencies have completed the cell for index. The dependencies are
+// read afresh each time, so one removed while the barrier waits on it stops holding it up.
+func (n *nodeBarrier) ready(index int64) bool {
+	deps := n.dependencies.Load().([][]int32)
+	need := n.quorum
+	if need == 0 {
+		need = len(deps)
+	}
+	lap := int32(index >> n.shift)
+	for _, dep := range deps {
+		if need == 0 {
+			break
+		}
+		if dep[index&n.mask] == lap {
+			need--
+		}
+	}
+	return need <= 0
+}
+
 // Stop breaks the loop cycle of the run.
 func (n *nodeBarrier) Stop() {
 	n.running = false
@@ -65,12 +117,50 @@ func (n *nodeBarrier) Running() bool {
 	return n.running
 }
 
-// AddDependency is a setter for a dependency of this barrier.
+// AddDependency is a setter for a dependency of this barrier. It may be called while the barrier is
+// running, with the node positioned by SetSequence at or after the barrier's Sequence. As the
+// dependencies are replaced rather than changed, Run never sees a partial update.
 func (n *nodeBarrier) AddDependency(dep []int32) {
-	n.dependencies = append(n.dependencies, dep)
+	n.mu.Lock()
+	old := n.dependencies.Load().([][]int32)
+	deps := make([][]int32, len(old), len(old)+1)
+	copy(deps, old)
+	n.dependencies.Store(append(deps, dep))
+	n.mu.Unlock()
+}
+
+// RemoveDependency removes a dependency while the barrier is running. It returns false if dep was not
+// found.
+func (n *nodeBarrier) RemoveDependency(dep []int32) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	old := n.dependencies.Load().([][]int32)
+	deps := make([][]int32, 0, len(old))
+	for _, d := range old {
+		if &d[0] != &dep[0] {
+			deps = append(deps, d)
+		}
+	}
+	if len(deps) == len(old) {
+		return false
+	}
+	n.dependencies.Store(deps)
+	return true
 }
 
 // Committed is a getter for the commit ring of this node.
 func (n *nodeBarrier) Committed() []int32 {
 	return n.committed
 }
+
+// Sequence returns the index of the next cell to be committed.
+func (n *nodeBarrier) Sequence() int64 {
+	return ringSequence(n.committed, atomic.LoadInt64(&n.cursor), n.shift)
+}
+
+// SetSequence positions the barrier so the next cell it waits for is at seq, and stamps its commit
+// ring as if every cell below seq had been committed. It must be called before the barrier is in use.
+func (n *nodeBarrier) SetSequence(seq int64) {
+	n.cursor = seq - 1
+	stampRing(n.committed, seq, n.shift)
+}
@@ -0,0 +1,59 @@
+package ringo
+
+// nodeBarrierPoller lets a caller that owns its loop drive a nodeBarrier in place of its Run loop.
+// Each Poll hands the cells the barrier can now mark to h and then marks them, so h sees each cell
+// once every dependency, or the quorum, has completed it, before any stage behind the barrier does.
+// The barrier is wired into the topology as usual, but is not Run.
+type nodeBarrierPoller struct {
+	barrier   *nodeBarrier // Tracks the cells marked.
+	publisher sequencer    // The publisher, used to tell gating from idle.
+}
+
+// NewNodeBarrierPoller is a factory function for returning a new instance of a nodeBarrierPoller.
+// p is the publisher of the ring. It lets Poll report PollGating instead of PollIdle while cells are
+// waiting on the dependencies, and keeps a barrier with none from marking cells not yet published.
+func NewNodeBarrierPoller(b *nodeBarrier, p sequencer) *nodeBarrierPoller {
+	return &nodeBarrierPoller{
+		barrier:   b,
+		publisher: p,
+	}
+}
+
+// Poll hands every cell the barrier can mark to h and marks them. It never waits. If h returns an
+// error, it is returned with every cell before the failed one marked, and the failed cell is handed
+// over again by the next Poll.
+func (n *nodeBarrierPoller) Poll(h Handler) (PollState, error) {
+	published := n.publisher.Sequence()
+	from, to := n.barrier.pollBatch()
+	if to > published {
+		to = published
+	}
+	if to <= from {
+		if published > from {
+			return PollGating, nil
+		}
+		return PollIdle, nil
+	}
+	return PollProcessing, poll(h, from, to, n.commit)
+}
+
+// commit marks the cells processed, from up to but not including to, and moves the cursor to the
+// last of them.
+func (n *nodeBarrierPoller) commit(from int64, to int64) {
+	for index := from; index < to; index++ {
+		n.barrier.committed[index&n.barrier.mask] = int32(index >> n.barrier.shift)
+	}
+	if to > from {
+		n.barrier.cursor = to - 1
+	}
+}
+
+// Barrier returns the barrier this poller drives.
+func (n *nodeBarrierPoller) Barrier() *nodeBarrier {
+	return n.barrier
+}
+
+// Sequence returns the index of the next cell to be marked.
+func (n *nodeBarrierPoller) Sequence() int64 {
+	return n.barrier.Sequence()
+}
@@ -0,0 +1,90 @@
+package ringo
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// nodeClearer is the Type 2 version of a consumeClearer. It resets each cell after the last consumer
+// has committed it, and the publisher depends on its commit ring in place of the last consumer's.
+type nodeClearer struct {
+	cachepad1  [8]int64 // Cacheline padding.
+	cursor     int64    // Tracks the cell id being processed in the ring.
+	cachepad2  [7]int64 // Cacheline padding.
+	committed  []int32  // Tracks this nodes progress.
+	dependency []int32  // The commit ring of the last consumer.
+	resetter   Resetter // Clears each cell.
+	mask       int64    // Used in place of modulo for index calculations.
+	shift      uint8    // Used to mark a cell with which rotation processed.
+	running    bool     // Is this clearer chasing the dependency in a Run() loop?
+}
+
+// NewNodeClearer is a factory function for returning a new instance of a nodeClearer.
+func NewNodeClearer(size int64, r Resetter) *nodeClearer {
+	c := &nodeClearer{
+		cursor:    int64(initSeqValue),
+		committed: make([]int32, size),
+		resetter:  r,
+		mask:      size - 1,
+		shift:     uint8(math.Log2(float64(size))),
+	}
+
+	for i := int64(0); i < size; i++ {
+		c.committed[i] = int32(initSeqValue)
+	}
+	return c
+}
+
+// Run continually resets the cells the dependency has finished with until Stop is called.
+func (c *nodeClearer) Run() {
+	c.running = true
+	for c.running {
+		index := c.cursor + 1
+
+		// Wait for the dependency to complete the cell.
+		for c.dependency[index&c.mask] != int32(index>>c.shift) {
+			if !c.running {
+				return
+			}
+			time.Sleep(time.Microsecond)
+		}
+
+		// Reset, mark and continue.
+		c.resetter.Reset(index)
+		atomic.StoreInt64(&c.cursor, index)
+		c.committed[index&c.mask] = int32(index >> c.shift)
+	}
+}
+
+// Stop breaks the loop cycle of the run.
+func (c *nodeClearer) Stop() {
+	c.running = false
+}
+
+// Running returns the state of the running flag.
+func (c *nodeClearer) Running() bool {
+	return c.running
+}
+
+// Committed is a getter for the commit ring of this node.
+func (c *nodeClearer) Committed() []int32 {
+	return c.committed
+}
+
+// SetDependency is a setter for the dependency of this node.
+func (c *nodeClearer) SetDependency(dep []int32) {
+	c.dependency = dep
+}
+
+// Sequence returns the index of the next cell to be reset.
+func (c *nodeClearer) Sequence() int64 {
+	return ringSequence(c.committed, atomic.LoadInt64(&c.cursor), c.shift)
+}
+
+// SetSequence positions the clearer so the next cell reset is at seq, and stamps its commit ring as
+// if every cell below seq had been reset. It must be called before the clearer is in use.
+func (c *nodeClearer) SetSequence(seq int64) {
+	c.cursor = seq - 1
+	stampRing(c.committed, seq, c.shift)
+}
@@ -0,0 +1,50 @@
+package ringo
+
+// nodePoller lets a caller that owns its loop consume from a simpleNode. Each Poll handles whatever
+// cells are available without waiting. The node is wired into the topology as usual; the poller takes
+// over its Reserve and Commit calls.
+type nodePoller struct {
+	node      *simpleNode // Tracks the cells processed.
+	publisher sequencer   // The publisher, used to tell gating from idle.
+}
+
+// NewNodePoller is a factory function for returning a new instance of a nodePoller.
+// p is the publisher of the ring. If the node depends on another stage rather than the publisher,
+// it lets Poll report PollGating instead of PollIdle while cells are waiting on that stage.
+func NewNodePoller(n *simpleNode, p sequencer) *nodePoller {
+	return &nodePoller{
+		node:      n,
+		publisher: p,
+	}
+}
+
+// Poll hands every cell currently available to h and commits them. It never waits. If h returns an
+// error, it is returned with every cell before the failed one committed, and the failed cell is
+// handed over again by the next Poll.
+func (n *nodePoller) Poll(h Handler) (PollState, error) {
+	from, to := n.node.pollBatch()
+	if from == to {
+		if n.publisher.Sequence() > from {
+			return PollGating, nil
+		}
+		return PollIdle, nil
+	}
+	return PollProcessing, poll(h, from, to, n.commit)
+}
+
+// commit marks the cells processed as completed, from up to but not including to, and moves the
+// cursor back so any cells of the batch left over are reserved again.
+func (n *nodePoller) commit(from int64, to int64) {
+	n.node.CommitBatch(from, to)
+	n.node.cursor = to - 1
+}
+
+// Node returns the node this poller drives.
+func (n *nodePoller) Node() *simpleNode {
+	return n.node
+}
+
+// Sequence returns the index of the next cell to be processed.
+func (n *nodePoller) Sequence() int64 {
+	return n.node.Sequence()
+}
@@ -0,0 +1,73 @@
+package ringo
+
+import (
+	"time"
+)
+
+// nodeProcessor runs a Handler over the cells reaching a simpleNode. In its Run loop it hands the
+// handler every cell the node's dependency has completed and then commits them as one batch. The node
+// is wired into the topology as usual; the processor takes over its Reserve and Commit calls.
+type nodeProcessor struct {
+	node *simpleNode // Tracks the cells processed.
+	processor
+}
+
+// NewNodeProcessor is a factory function for returning a new instance of a nodeProcessor.
+func NewNodeProcessor(n *simpleNode, h Handler) *nodeProcessor {
+	p := &nodeProcessor{
+		node: n,
+	}
+	p.init(h, p.commit)
+	return p
+}
+
+// Run continually processes the cells completed by the node's dependency until Stop is called or the
+// handler returns an error. The error is returned with every cell before the failed one committed.
+// Run may be called again after it returns, to carry on from the failed cell.
+func (n *nodeProcessor) Run() (err error) {
+	if err := n.start(); err != nil {
+		return err
+	}
+	defer n.shutdown(&err)
+	defer n.rewind()
+
+	for n.running {
+		n.park(n.node.Sequence())
+		from, to := n.node.pollBatch()
+		if from == to {
+			if err := n.idle(from); err != nil {
+				return err
+			}
+			time.Sleep(time.Microsecond)
+			continue
+		}
+		if err := n.process(from, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit marks the cells processed as completed, from up to but not including to.
+func (n *nodeProcessor) commit(from int64, to int64) {
+	n.node.CommitBatch(from, to)
+}
+
+// rewind moves the cursor back to the first cell of an unfinished batch that was not committed, so it
+// is reserved again when Run is next called.
+func (n *nodeProcessor) rewind() {
+	if n.done < n.end {
+		n.node.cursor = n.done - 1
+		n.end = n.done
+	}
+}
+
+// Node returns the node this processor drives.
+func (n *nodeProcessor) Node() *simpleNode {
+	return n.node
+}
+
+// Sequence returns the index of the next cell to be processed.
+func (n *nodeProcessor) Sequence() int64 {
+	return n.node.Sequence()
+}
@@ -0,0 +1,76 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package ringo
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+// offHeapStore holds the slots of a ring in memory mapped outside of the Go heap. A ring of pointers
+// to structs, as in the README, gives the garbage collector a pointer to follow for every slot on
+// every cycle. Storing the structs themselves off the heap gives it nothing to scan, however large
+// the ring. The structs must not contain pointers, slices, strings, maps or interfaces, since the
+// garbage collector cannot see anything they refer to.
+// The store only holds the data. Any node type can be used to coordinate access to it, with the
+// index it hands out passed to Pointer or Bytes.
+type offHeapStore struct {
+	mem      []byte // The mapped memory.
+	slotSize int64  // Size of a slot in bytes, rounded up to keep every slot 8 byte aligned.
+	mask     int64  // Used in place of modulo for index calculations.
+}
+
+// NewOffHeapStore is a factory function that maps an offHeapStore of size slots, each holding
+// slotSize bytes, zeroed. size must be a power of two. If hugePages is set the memory is backed by
+// huge pages where the platform supports them, to save TLB misses on large rings.
+func NewOffHeapStore(slotSize int, size int64, hugePages bool) (*offHeapStore, error) {
+	if slotSize <= 0 {
+		return nil, errors.New("ringo: slot size must be positive")
+	}
+	if size <= 0 || size&(size-1) != 0 {
+		return nil, errors.New("ringo: store size must be a power of two")
+	}
+	s := &offHeapStore{
+		slotSize: alignRecord(int64(slotSize)),
+		mask:     size - 1,
+	}
+	mem, err := mapAnonymous(int(s.slotSize*size), hugePages)
+	if err != nil {
+		return nil, err
+	}
+	s.mem = mem
+	return s, nil
+}
+
+// Pointer returns the address of the slot for index, for converting to a pointer to the struct
+// stored there:
+//
+//	work := (*MyWorkStruct)(store.Pointer(index))
+//
+// The pointer is only valid until Close.
+func (s *offHeapStore) Pointer(index int64) unsafe.Pointer {
+	return unsafe.Pointer(&s.mem[(index&s.mask)*s.slotSize])
+}
+
+// Bytes returns the bytes of the slot for index. The slice is only valid until Close.
+func (s *offHeapStore) Bytes(index int64) []byte {
+	offset := (index & s.mask) * s.slotSize
+	return s.mem[offset : offset+s.slotSize : offset+s.slotSize]
+}
+
+// SlotSize returns the size of each slot in bytes.
+func (s *offHeapStore) SlotSize() int {
+	return int(s.slotSize)
+}
+
+// Close unmaps the store. No slot may be used afterwards.
+func (s *offHeapStore) Close() error {
+	if s.mem == nil {
+		return nil
+	}
+	err := syscall.Munmap(s.mem)
+	s.mem = nil
+	return err
+}
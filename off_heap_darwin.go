@@ -0,0 +1,12 @@
+//go:build darwin
+// +build darwin
+
+package ringo
+
+import "syscall"
+
+// mapAnonymous maps length bytes of zeroed memory. Huge pages are not requested on darwin, which
+// only offers them through the Mach VM calls.
+func mapAnonymous(length int, huge bool) ([]byte, error) {
+	return syscall.Mmap(-1, 0, length, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+}
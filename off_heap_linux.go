@@ -0,0 +1,29 @@
+//go:build linux
+// +build linux
+
+package ringo
+
+import "syscall"
+
+// madviseHugePage asks for transparent huge pages. It is not in the syscall package.
+const madviseHugePage = 14
+
+// mapAnonymous maps at least length bytes of zeroed memory. With huge set, explicit huge pages are
+// tried first, rounding the length up to a whole huge page. If none are reserved, the kernel is asked
+// to back the memory with transparent huge pages instead.
+func mapAnonymous(length int, huge bool) ([]byte, error) {
+	const prot = syscall.PROT_READ | syscall.PROT_WRITE
+	const flags = syscall.MAP_PRIVATE | syscall.MAP_ANONYMOUS
+	if huge {
+		const hugeSize = 2 << 20
+		rounded := (length + hugeSize - 1) &^ (hugeSize - 1)
+		if mem, err := syscall.Mmap(-1, 0, rounded, prot, flags|syscall.MAP_HUGETLB); err == nil {
+			return mem, nil
+		}
+	}
+	mem, err := syscall.Mmap(-1, 0, length, prot, flags)
+	if err == nil && huge {
+		syscall.Madvise(mem, madviseHugePage)
+	}
+	return mem, err
+}
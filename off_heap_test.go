@@ -0,0 +1,108 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package ringo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+// offHeapWork is a pointer free event that can be kept off the heap.
+type offHeapWork struct {
+	value int64
+	twice int64
+	flag  int32
+}
+
+// A simple queue with its events off the heap: Publisher <==> Consumer
+func TestOffHeapStore(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	for _, huge := range []bool{false, true} {
+		store, err := NewOffHeapStore(20, 32, huge)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if store.SlotSize() != 24 || len(store.Bytes(5)) != 24 {
+			t.Errorf("Expected 24 byte slots, got %d", store.SlotSize())
+		}
+		for _, b := range store.Bytes(31) {
+			if b != 0 {
+				t.Fatalf("Expected zeroed slots")
+			}
+		}
+
+		publisher := NewSimplePublishNode(32)
+		consumer := NewSimpleConsumeNode()
+		publisher.SetDependency(consumer.Committed())
+		consumer.SetDependency(publisher.Committed())
+
+		done := make(chan bool)
+
+		go func() {
+			for i := int64(0); i < 1024; i++ {
+				work := (*offHeapWork)(store.Pointer(*consumer.Reserve()))
+				if work.value != i || work.twice != 2*i || work.flag != 1 {
+					t.Errorf("Unexpected work at %d: %+v", i, *work)
+				}
+				consumer.Commit()
+			}
+			close(done)
+		}()
+
+		for i := int64(0); i < 1024; i++ {
+			work := (*offHeapWork)(store.Pointer(*publisher.Reserve()))
+			*work = offHeapWork{value: i, twice: 2 * i, flag: 1}
+			publisher.Commit()
+		}
+		<-done
+
+		if err := store.Close(); err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+		if err := store.Close(); err != nil {
+			t.Errorf("Unexpected error on second close: %s", err)
+		}
+	}
+}
+
+// benchmarkGCPause times forced garbage collections while a ring of size events is held, reporting
+// the stop the world pause of each collection alongside the time taken for the whole collection.
+func benchmarkGCPause(b *testing.B, ring interface{}) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(after.NumGC-before.NumGC), "pause-ns/gc")
+	runtime.KeepAlive(ring)
+}
+
+// The README layout: a PT4Meg ring of pointers to structs on the heap.
+func BenchmarkGCPauseHeap(b *testing.B) {
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	ring := make([]*offHeapWork, PT4Meg)
+	for i := range ring {
+		ring[i] = &offHeapWork{}
+	}
+	benchmarkGCPause(b, ring)
+}
+
+// The same ring held in an offHeapStore.
+func BenchmarkGCPauseOffHeap(b *testing.B) {
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	store, err := NewOffHeapStore(24, PT4Meg, false)
+	if err != nil {
+		b.Fatalf("Unexpected error: %s", err)
+	}
+	defer store.Close()
+	benchmarkGCPause(b, store)
+}
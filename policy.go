@@ -0,0 +1,133 @@
+package ringo
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Policy decides what a publishers TryReserve does when the ring is full.
+type Policy int
+
+const (
+	PolicyBlock      Policy = iota // Wait until room frees up. This is the default.
+	PolicyFailFast                 // Refuse the event with ErrFull.
+	PolicyDropNewest               // Discard the incoming event with ErrDropped.
+	PolicyDropOldest               // Overwrite the oldest unconsumed event.
+)
+
+var (
+	// ErrFull is returned by TryReserve when the ring is full and the policy is PolicyFailFast.
+	ErrFull = errors.New("ringo: ring buffer is full")
+
+	// ErrDropped is returned by TryReserve when the ring is full and the policy is PolicyDropNewest.
+	// The event should be discarded.
+	ErrDropped = errors.New("ringo: event dropped, ring buffer is full")
+)
+
+// PublishStats counts how a publishers reservations on a full ring were resolved.
+type PublishStats struct {
+	Blocked  int64 // Reservations that waited for room.
+	Rejected int64 // Reservations refused with ErrFull.
+	Dropped  int64 // Incoming events discarded with ErrDropped.
+	Evicted  int64 // Unconsumed events overwritten to make room.
+}
+
+// publishPolicy holds the full ring policy of a publisher and the counters of its outcomes.
+// When evicting, the publisher records that the oldest cell is lost before it overwrites it without
+// waiting. The consumers of an evicting publisher must follow it with SetEvictor. They then skip
+// the events that are lost instead of reading the newer event stored in their cells, and can check
+// that an event was not overwritten while they read it.
+type publishPolicy struct {
+	policy   Policy // What to do when the ring is full.
+	oldest   int64  // The oldest index that has not been overwritten by an eviction.
+	blocked  int64  // Count of reservations that waited.
+	rejected int64  // Count of reservations refused.
+	dropped  int64  // Count of incoming events discarded.
+	evicted  int64  // Count of unconsumed events overwritten.
+}
+
+// evictor is a publisher whose PolicyDropOldest may overwrite cells before its consumers are done.
+type evictor interface {
+	// Oldest returns the oldest index that has not been overwritten by an eviction.
+	Oldest() int64
+}
+
+// SetPolicy is a setter for the full ring policy used by TryReserve.
+func (p *publishPolicy) SetPolicy(policy Policy) {
+	p.policy = policy
+}
+
+// Policy is a getter for the full ring policy used by TryReserve.
+func (p *publishPolicy) Policy() Policy {
+	return p.policy
+}
+
+// Stats returns a snapshot of the full ring outcome counters.
+func (p *publishPolicy) Stats() PublishStats {
+	return PublishStats{
+		Blocked:  atomic.LoadInt64(&p.blocked),
+		Rejected: atomic.LoadInt64(&p.rejected),
+		Dropped:  atomic.LoadInt64(&p.dropped),
+		Evicted:  atomic.LoadInt64(&p.evicted),
+	}
+}
+
+// Oldest returns the oldest index that has not been overwritten by an eviction.
+func (p *publishPolicy) Oldest() int64 {
+	return atomic.LoadInt64(&p.oldest)
+}
+
+// evict records that the cell for index is about to be overwritten in a ring of size, losing the
+// event at index-size and any before it. It must be called before the cell is written, so a consumer
+// that checks Oldest after reading a cell knows whether what it read can be trusted.
+func (p *publishPolicy) evict(index int64, size int64) {
+	for {
+		oldest := atomic.LoadInt64(&p.oldest)
+		if index-size+1 <= oldest || atomic.CompareAndSwapInt64(&p.oldest, oldest, index-size+1) {
+			return
+		}
+	}
+}
+
+// evictable holds what a consumer needs to follow an evicting publisher.
+type evictable struct {
+	evictor evictor // The evicting publisher followed, if any.
+	missed  int64   // Count of events skipped because they were evicted before they were read.
+}
+
+// SetEvictor sets the publisher whose PolicyDropOldest may overwrite events before this consumer
+// reads them. Every consumer of an evicting publisher, at every stage, must follow it. Without an
+// evictor a consumer assumes no event is lost.
+func (e *evictable) SetEvictor(p evictor) {
+	e.evictor = p
+}
+
+// Evicted reports whether the event at index has been overwritten by an eviction. Call it once an
+// event has been read: if true, what was read is a later event, or part of one, and must be discarded.
+func (e *evictable) Evicted(index int64) bool {
+	return e.evictor != nil && index < e.evictor.Oldest()
+}
+
+// Missed returns the count of events skipped because they were evicted before they were reserved.
+func (e *evictable) Missed() int64 {
+	return atomic.LoadInt64(&e.missed)
+}
+
+// full applies the policy to a reservation that found the ring full and counts the outcome.
+// It returns true if the caller should wait for room, or the error to hand back to the caller.
+// If neither, the policy is PolicyDropOldest and the caller must evict the oldest cell.
+func (p *publishPolicy) full() (bool, error) {
+	switch p.policy {
+	case PolicyFailFast:
+		atomic.AddInt64(&p.rejected, 1)
+		return false, ErrFull
+	case PolicyDropNewest:
+		atomic.AddInt64(&p.dropped, 1)
+		return false, ErrDropped
+	case PolicyDropOldest:
+		atomic.AddInt64(&p.evicted, 1)
+		return false, nil
+	}
+	atomic.AddInt64(&p.blocked, 1)
+	return true, nil
+}
@@ -0,0 +1,371 @@
+package ringo
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Fill a ring whose consumer never reads and check each publishers full ring outcome.
+func TestPolicyType1(t *testing.T) {
+	consumer := NewSimpleConsumeNode()
+
+	simple := NewSimplePublishNode(8)
+	simple.SetDependency(consumer.Committed())
+	multi := NewMultiPublishNode(8)
+	multi.SetDependency(consumer.Committed())
+
+	tryReserves := map[string]func() error{
+		"simplePublishNode": func() error {
+			_, err := simple.TryReserve()
+			if err == nil {
+				simple.Commit()
+			}
+			return err
+		},
+		"multiPublishNode": func() error {
+			_, err := multi.TryReserve()
+			if err == nil {
+				multi.Commit()
+			}
+			return err
+		},
+	}
+	policies := map[string]*publishPolicy{
+		"simplePublishNode": &simple.publishPolicy,
+		"multiPublishNode":  &multi.publishPolicy,
+	}
+	for name, tryReserve := range tryReserves {
+		testPolicy(t, name, policies[name], tryReserve)
+	}
+}
+
+func TestPolicyType2(t *testing.T) {
+	consumer := NewSimpleNode(false, 8)
+
+	simple := NewSimpleNode(true, 8)
+	simple.SetDependency(consumer.Committed())
+	multi := NewMultiNode(true, 8)
+	multi.SetDependency(consumer.Committed())
+
+	tryReserves := map[string]func() error{
+		"simpleNode": func() error {
+			ndx, err := simple.TryReserve()
+			if err == nil {
+				simple.Commit(ndx)
+			}
+			return err
+		},
+		"multiNode": func() error {
+			ndx, err := multi.TryReserve()
+			if err == nil {
+				multi.Commit(ndx)
+			}
+			return err
+		},
+	}
+	policies := map[string]*publishPolicy{
+		"simpleNode": &simple.publishPolicy,
+		"multiNode":  &multi.publishPolicy,
+	}
+	for name, tryReserve := range tryReserves {
+		testPolicy(t, name, policies[name], tryReserve)
+	}
+}
+
+// testPolicy fills the ring and then walks a publisher through the refusing policies.
+func testPolicy(t *testing.T, name string, p *publishPolicy, tryReserve func() error) {
+	for i := 0; i < 8; i++ {
+		if err := tryReserve(); err != nil {
+			t.Fatalf("%s: unexpected error filling the ring: %s", name, err)
+		}
+	}
+
+	p.SetPolicy(PolicyFailFast)
+	if err := tryReserve(); err != ErrFull {
+		t.Errorf("%s: expected ErrFull, got %v.", name, err)
+	}
+	p.SetPolicy(PolicyDropNewest)
+	for i := 0; i < 2; i++ {
+		if err := tryReserve(); err != ErrDropped {
+			t.Errorf("%s: expected ErrDropped, got %v.", name, err)
+		}
+	}
+	p.SetPolicy(PolicyDropOldest)
+	for i := 0; i < 3; i++ {
+		if err := tryReserve(); err != nil {
+			t.Errorf("%s: expected the oldest to be evicted, got %v.", name, err)
+		}
+	}
+
+	expected := PublishStats{Rejected: 1, Dropped: 2, Evicted: 3}
+	if stats := p.Stats(); stats != expected {
+		t.Errorf("%s: expected %+v, got %+v.", name, expected, stats)
+	}
+}
+
+// A simple queue with a blocking TryReserve: Publisher <==> Consumer
+func TestPolicyBlock(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	master := NewSimpleNode(true, 8)
+	slave := NewSimpleNode(false, 8)
+	master.SetDependency(slave.Committed())
+	slave.SetDependency(master.Committed())
+
+	done := make(chan bool)
+
+	go func() {
+		for i := int64(0); i < 64; i++ {
+			ndx := slave.Reserve()
+			slave.Commit(ndx)
+		}
+		close(done)
+	}()
+
+	for i := int64(0); i < 64; i++ {
+		ndx, err := master.TryReserve()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		master.Commit(ndx)
+	}
+	<-done
+}
+
+// evictionLog records what a consumer of an evicting publisher actually received.
+type evictionLog struct {
+	received  []int64 // Indexes read intact.
+	discarded int64   // Events overwritten while they were read.
+}
+
+// check reports any event received out of order or with the payload of another, and that every
+// event was either received, discarded or skipped.
+func (l *evictionLog) check(t *testing.T, name string, missed int64, total int64) {
+	for i, ndx := range l.received {
+		if i > 0 && ndx <= l.received[i-1] {
+			t.Errorf("%s: received %d after %d", name, ndx, l.received[i-1])
+		}
+	}
+	if got := int64(len(l.received)) + l.discarded + missed; got != total {
+		t.Errorf("%s: %d received, %d discarded and %d missed, expected %d in all", name,
+			len(l.received), l.discarded, missed, total)
+	}
+	if l.received[len(l.received)-1] != total-1 {
+		t.Errorf("%s: expected the last event to arrive, got %d", name, l.received[len(l.received)-1])
+	}
+}
+
+// read checks the payload at ndx and records it, unless it was evicted while it was read.
+func (l *evictionLog) read(t *testing.T, name string, ring []int64, ndx int64, evicted func(int64) bool) {
+	payload := atomic.LoadInt64(&ring[ndx&7])
+	if evicted(ndx) {
+		l.discarded++
+		return
+	}
+	if payload != ndx*10 {
+		t.Errorf("%s: expected payload %d at %d, got %d", name, ndx*10, ndx, payload)
+	}
+	l.received = append(l.received, ndx)
+}
+
+// A publisher evicting from two slow stages of consumers, which skip what they lose and never read
+// an event at the wrong index:
+// 1 SimplePublishNode => 1 SimpleConsumeNode => 1 SimpleConsumeNode => back to the publisher
+func TestPolicyDropOldestType1(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	const total = 2000
+	ring := make([]int64, 8)
+
+	// Build the components
+	publisher := NewSimplePublishNode(8)
+	publisher.SetPolicy(PolicyDropOldest)
+	consumer1 := NewSimpleConsumeNode()
+	consumer2 := NewSimpleConsumeNode()
+
+	// Link the committed counter dependencies together. Both stages follow the evicting publisher.
+	consumer1.SetDependency(publisher.Committed())
+	consumer2.SetDependency(consumer1.Committed())
+	publisher.SetDependency(consumer2.Committed())
+	consumer1.SetEvictor(publisher)
+	consumer2.SetEvictor(publisher)
+
+	logs := []*evictionLog{{}, {}}
+	var wg sync.WaitGroup
+	for i, c := range []*simpleConsumeNode{consumer1, consumer2} {
+		wg.Add(1)
+		go func(l *evictionLog, c *simpleConsumeNode) {
+			defer wg.Done()
+			for {
+				ndx := *c.Reserve()
+				l.read(t, "Type 1", ring, ndx, c.Evicted)
+				c.Commit()
+				if ndx == total-1 {
+					return
+				}
+				time.Sleep(time.Microsecond)
+			}
+		}(logs[i], c)
+	}
+
+	for i := int64(0); i < total; i++ {
+		ndx, err := publisher.TryReserve()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		atomic.StoreInt64(&ring[*ndx&7], *ndx*10)
+		publisher.Commit()
+	}
+	wg.Wait()
+
+	if publisher.Stats().Evicted == 0 {
+		t.Error("Expected the publisher to evict")
+	}
+	logs[0].check(t, "Type 1 stage 1", consumer1.Missed(), total)
+	logs[1].check(t, "Type 1 stage 2", consumer2.Missed(), total)
+}
+
+// The same with Type 2 nodes:
+// 1 SimpleNode => 1 SimpleNode => 1 SimpleNode => back to the publisher
+func TestPolicyDropOldestType2(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	const total = 2000
+	ring := make([]int64, 8)
+
+	// Build the components
+	publisher := NewSimpleNode(true, 8)
+	publisher.SetPolicy(PolicyDropOldest)
+	consumer1 := NewSimpleNode(false, 8)
+	consumer2 := NewSimpleNode(false, 8)
+
+	// Link the commit rings together. Both stages follow the evicting publisher.
+	consumer1.SetDependency(publisher.Committed())
+	consumer2.SetDependency(consumer1.Committed())
+	publisher.SetDependency(consumer2.Committed())
+	consumer1.SetEvictor(publisher)
+	consumer2.SetEvictor(publisher)
+
+	logs := []*evictionLog{{}, {}}
+	var wg sync.WaitGroup
+	for i, c := range []*simpleNode{consumer1, consumer2} {
+		wg.Add(1)
+		go func(l *evictionLog, c *simpleNode) {
+			defer wg.Done()
+			for {
+				ndx := c.Reserve()
+				l.read(t, "Type 2", ring, ndx, c.Evicted)
+				c.Commit(ndx)
+				if ndx == total-1 {
+					return
+				}
+				time.Sleep(time.Microsecond)
+			}
+		}(logs[i], c)
+	}
+
+	for i := int64(0); i < total; i++ {
+		ndx, err := publisher.TryReserve()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		atomic.StoreInt64(&ring[ndx&7], ndx*10)
+		publisher.Commit(ndx)
+	}
+	wg.Wait()
+
+	if publisher.Stats().Evicted == 0 {
+		t.Error("Expected the publisher to evict")
+	}
+	logs[0].check(t, "Type 2 stage 1", consumer1.Missed(), total)
+	logs[1].check(t, "Type 2 stage 2", consumer2.Missed(), total)
+}
+
+// A multiNode sharing the events of an evicting publisher between two go routines, which skip what
+// they lose between them:
+// 1 SimpleNode => 1 MultiNode(2 goroutines) => back to the publisher
+func TestPolicyDropOldestMultiNode(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	const total = 2000
+	ring := make([]int64, 8)
+
+	// Build the components
+	publisher := NewSimpleNode(true, 8)
+	publisher.SetPolicy(PolicyDropOldest)
+	consumer := NewMultiNode(false, 8)
+
+	// Link the commit rings together. The consumer follows the evicting publisher.
+	consumer.SetDependency(publisher.Committed())
+	publisher.SetDependency(consumer.Committed())
+	consumer.SetEvictor(publisher)
+
+	// Each go routine stops at the first event past the total.
+	logs := []*evictionLog{{}, {}}
+	var wg sync.WaitGroup
+	for _, l := range logs {
+		wg.Add(1)
+		go func(l *evictionLog) {
+			defer wg.Done()
+			for {
+				ndx := consumer.Reserve()
+				if ndx >= total {
+					consumer.Commit(ndx)
+					return
+				}
+				l.read(t, "MultiNode", ring, ndx, consumer.Evicted)
+				consumer.Commit(ndx)
+				time.Sleep(time.Microsecond)
+			}
+		}(l)
+	}
+
+	for i := int64(0); i < total; i++ {
+		ndx, err := publisher.TryReserve()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		atomic.StoreInt64(&ring[ndx&7], ndx*10)
+		publisher.Commit(ndx)
+	}
+	for range logs {
+		publisher.Commit(publisher.Reserve())
+	}
+	wg.Wait()
+
+	if publisher.Stats().Evicted == 0 {
+		t.Error("Expected the publisher to evict")
+	}
+	seen := make(map[int64]bool)
+	received := 0
+	for _, l := range logs {
+		for i, ndx := range l.received {
+			if i > 0 && ndx <= l.received[i-1] {
+				t.Errorf("MultiNode: received %d after %d", ndx, l.received[i-1])
+			}
+			if seen[ndx] {
+				t.Errorf("MultiNode: received %d twice", ndx)
+			}
+			seen[ndx] = true
+		}
+		received += len(l.received)
+	}
+	if got := int64(received) + logs[0].discarded + logs[1].discarded + consumer.Missed(); got != total {
+		t.Errorf("MultiNode: %d received, %d discarded and %d missed, expected %d in all", received,
+			logs[0].discarded+logs[1].discarded, consumer.Missed(), total)
+	}
+	if !seen[total-1] {
+		t.Error("MultiNode: expected the last event to arrive")
+	}
+}
@@ -0,0 +1,36 @@
+package ringo
+
+// PollState reports what a poller found.
+type PollState int
+
+const (
+	PollIdle       PollState = iota // Nothing has been published past the poller.
+	PollProcessing                  // Events were handed to the handler.
+	PollGating                      // Events are published but a stage ahead has not finished them.
+)
+
+// Poller is a consumer driven from the caller's own loop. Each Poll hands whatever events are
+// available to h and commits them, without waiting, and reports what it found.
+// simpleConsumeNode, simpleNode and multiNode consumers are polled through NewConsumePoller,
+// NewNodePoller and NewMultiPoller, and barriers through NewBarrierPoller and NewNodeBarrierPoller in
+// place of their Run loops. The reads of broadcastReader, messageRing and shmConsumer all wait, so
+// each of these still needs a go routine of its own.
+type Poller interface {
+	Poll(h Handler) (PollState, error)
+	Sequence() int64
+}
+
+// poll hands the events from up to but not including to to h and then commits them with commit.
+// If h fails or panics, only the events before the failed one are committed.
+func poll(h Handler, from int64, to int64, commit func(from int64, to int64)) error {
+	seq := from
+	defer func() {
+		commit(from, seq)
+	}()
+	for ; seq < to; seq++ {
+		if err := h.OnEvent(seq, seq == to-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
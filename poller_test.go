@@ -0,0 +1,372 @@
+package ringo
+
+import (
+	"errors"
+	"testing"
+)
+
+// A poller behind another consumer, driven from the test's own loop:
+// 1 SimplePublishNode => 1 SimpleConsumeNode => 1 ConsumePoller => back to the publisher
+func TestConsumePoller(t *testing.T) {
+	errBad := errors.New("bad event")
+	var handled []int64
+	failed := false
+	h := HandlerFunc(func(seq int64, endOfBatch bool) error {
+		if seq == 4 && !failed {
+			failed = true
+			return errBad
+		}
+		handled = append(handled, seq)
+		return nil
+	})
+
+	// Build the components
+	publisher := NewSimplePublishNode(8)
+	consumer := NewSimpleConsumeNode()
+	poller := NewConsumePoller(NewSimpleConsumeNode(), publisher)
+
+	// Link the committed counter dependencies together.
+	consumer.SetDependency(publisher.Committed())
+	poller.Node().SetDependency(consumer.Committed())
+	publisher.SetDependency(poller.Node().Committed())
+
+	if state, err := poller.Poll(h); state != PollIdle || err != nil {
+		t.Fatalf("Expected idle, got %d and %v", state, err)
+	}
+	for i := 0; i < 6; i++ {
+		publisher.Reserve()
+		publisher.Commit()
+	}
+	if state, err := poller.Poll(h); state != PollGating || err != nil {
+		t.Fatalf("Expected gating, got %d and %v", state, err)
+	}
+
+	// The consumer ahead finishes three events, then the rest.
+	for i := 0; i < 3; i++ {
+		consumer.Reserve()
+		consumer.Commit()
+	}
+	if state, err := poller.Poll(h); state != PollProcessing || err != nil || len(handled) != 3 {
+		t.Fatalf("Expected 3 processed, got %d, %v and %v", state, err, handled)
+	}
+	consumer.CommitBatch(6)
+	if state, err := poller.Poll(h); state != PollProcessing || err != errBad {
+		t.Fatalf("Expected the handler error, got %d and %v", state, err)
+	}
+	if poller.Sequence() != 4 {
+		t.Fatalf("Expected the failed event to be left uncommitted, got %d", poller.Sequence())
+	}
+	if state, err := poller.Poll(h); state != PollProcessing || err != nil || len(handled) != 6 {
+		t.Fatalf("Expected the rest processed, got %d, %v and %v", state, err, handled)
+	}
+	if state, err := poller.Poll(h); state != PollIdle || err != nil {
+		t.Fatalf("Expected idle, got %d and %v", state, err)
+	}
+	for i, seq := range handled {
+		if seq != int64(i) {
+			t.Errorf("Expected event %d, got %d", i, seq)
+		}
+	}
+}
+
+// The same with Type 2 nodes:
+// 1 SimpleNode => 1 SimpleNode => 1 NodePoller => back to the publisher
+func TestNodePoller(t *testing.T) {
+	errBad := errors.New("bad event")
+	var handled []int64
+	failed := false
+	h := HandlerFunc(func(seq int64, endOfBatch bool) error {
+		if seq == 4 && !failed {
+			failed = true
+			return errBad
+		}
+		handled = append(handled, seq)
+		return nil
+	})
+
+	// Build the components
+	publisher := NewSimpleNode(true, 8)
+	consumer := NewSimpleNode(false, 8)
+	poller := NewNodePoller(NewSimpleNode(false, 8), publisher)
+
+	// Link the commit rings together.
+	consumer.SetDependency(publisher.Committed())
+	poller.Node().SetDependency(consumer.Committed())
+	publisher.SetDependency(poller.Node().Committed())
+
+	if state, err := poller.Poll(h); state != PollIdle || err != nil {
+		t.Fatalf("Expected idle, got %d and %v", state, err)
+	}
+	for i := 0; i < 6; i++ {
+		publisher.Commit(publisher.Reserve())
+	}
+	if state, err := poller.Poll(h); state != PollGating || err != nil {
+		t.Fatalf("Expected gating, got %d and %v", state, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		consumer.Commit(consumer.Reserve())
+	}
+	if state, err := poller.Poll(h); state != PollProcessing || err != nil || len(handled) != 3 {
+		t.Fatalf("Expected 3 processed, got %d, %v and %v", state, err, handled)
+	}
+	for i := 0; i < 3; i++ {
+		consumer.Commit(consumer.Reserve())
+	}
+	if state, err := poller.Poll(h); state != PollProcessing || err != errBad {
+		t.Fatalf("Expected the handler error, got %d and %v", state, err)
+	}
+	if poller.Sequence() != 4 {
+		t.Fatalf("Expected the failed cell to be left uncommitted, got %d", poller.Sequence())
+	}
+	if state, err := poller.Poll(h); state != PollProcessing || err != nil || len(handled) != 6 {
+		t.Fatalf("Expected the rest processed, got %d, %v and %v", state, err, handled)
+	}
+	if state, err := poller.Poll(h); state != PollIdle || err != nil {
+		t.Fatalf("Expected idle, got %d and %v", state, err)
+	}
+	for i, seq := range handled {
+		if seq != int64(i) {
+			t.Errorf("Expected cell %d, got %d", i, seq)
+		}
+	}
+}
+
+// Two pollers sharing a multiNode, where a failed batch stays with the poller that claimed it:
+// 1 SimpleNode => 1 MultiNode => 2 MultiPoller => back to the publisher
+func TestMultiPoller(t *testing.T) {
+	errBad := errors.New("bad event")
+	handled := make(map[int64]int)
+	failed := false
+	h := HandlerFunc(func(seq int64, endOfBatch bool) error {
+		if seq == 2 && !failed {
+			failed = true
+			return errBad
+		}
+		handled[seq]++
+		return nil
+	})
+
+	// Build the components
+	publisher := NewSimpleNode(true, 8)
+	consumer := NewMultiNode(false, 8)
+	poller1 := NewMultiPoller(consumer, publisher)
+	poller2 := NewMultiPoller(consumer, publisher)
+
+	// Link the commit rings together.
+	consumer.SetDependency(publisher.Committed())
+	publisher.SetDependency(consumer.Committed())
+
+	if state, err := poller1.Poll(h); state != PollIdle || err != nil {
+		t.Fatalf("Expected idle, got %d and %v", state, err)
+	}
+	for i := 0; i < 6; i++ {
+		publisher.Commit(publisher.Reserve())
+	}
+	if state, err := poller1.Poll(h); state != PollProcessing || err != errBad || len(handled) != 2 {
+		t.Fatalf("Expected the handler error after 2, got %d, %v and %v", state, err, handled)
+	}
+
+	// The rest of the failed batch is held by the first poller, so the second finds nothing.
+	if state, err := poller2.Poll(h); state != PollIdle || err != nil {
+		t.Fatalf("Expected idle, got %d and %v", state, err)
+	}
+	if poller2.Sequence() != 2 {
+		t.Fatalf("Expected the failed cell to be left uncommitted, got %d", poller2.Sequence())
+	}
+	for i := 0; i < 2; i++ {
+		publisher.Commit(publisher.Reserve())
+	}
+	if state, err := poller2.Poll(h); state != PollProcessing || err != nil || len(handled) != 4 {
+		t.Fatalf("Expected 2 more processed, got %d, %v and %v", state, err, handled)
+	}
+	if poller1.Sequence() != 2 {
+		t.Fatalf("Expected the held cells to stay uncommitted, got %d", poller1.Sequence())
+	}
+	if state, err := poller1.Poll(h); state != PollProcessing || err != nil || len(handled) != 8 {
+		t.Fatalf("Expected the held cells processed, got %d, %v and %v", state, err, handled)
+	}
+	if state, err := poller1.Poll(h); state != PollIdle || err != nil || poller1.Sequence() != 8 {
+		t.Fatalf("Expected idle at 8, got %d, %v and %d", state, err, poller1.Sequence())
+	}
+	for seq := int64(0); seq < 8; seq++ {
+		if handled[seq] != 1 {
+			t.Errorf("Expected cell %d handled once, got %d", seq, handled[seq])
+		}
+	}
+}
+
+// A barrier driven from the test's own loop instead of its Run:
+// 1 SimplePublishNode => 2 SimpleConsumeNode => 1 BarrierPoller => back to the publisher
+func TestBarrierPoller(t *testing.T) {
+	errBad := errors.New("bad event")
+	var handled []int64
+	failed := false
+	h := HandlerFunc(func(seq int64, endOfBatch bool) error {
+		if seq == 3 && !failed {
+			failed = true
+			return errBad
+		}
+		handled = append(handled, seq)
+		return nil
+	})
+
+	// Build the components
+	publisher := NewSimplePublishNode(8)
+	consumer1 := NewSimpleConsumeNode()
+	consumer2 := NewSimpleConsumeNode()
+	poller := NewBarrierPoller(NewConsumeBarrier(), publisher)
+
+	// Link the committed counter dependencies together.
+	consumer1.SetDependency(publisher.Committed())
+	consumer2.SetDependency(publisher.Committed())
+	poller.Barrier().AddDependency(consumer1.Committed())
+	poller.Barrier().AddDependency(consumer2.Committed())
+	publisher.SetDependency(poller.Barrier().Committed())
+
+	if state, err := poller.Poll(h); state != PollIdle || err != nil {
+		t.Fatalf("Expected idle, got %d and %v", state, err)
+	}
+	for i := 0; i < 4; i++ {
+		publisher.Reserve()
+		publisher.Commit()
+	}
+	if state, err := poller.Poll(h); state != PollGating || err != nil {
+		t.Fatalf("Expected gating, got %d and %v", state, err)
+	}
+
+	// The barrier passes what the slower consumer has finished.
+	consumer1.CommitBatch(4)
+	consumer2.CommitBatch(2)
+	if state, err := poller.Poll(h); state != PollProcessing || err != nil || len(handled) != 2 {
+		t.Fatalf("Expected 2 processed, got %d, %v and %v", state, err, handled)
+	}
+	consumer2.CommitBatch(4)
+	if state, err := poller.Poll(h); state != PollProcessing || err != errBad {
+		t.Fatalf("Expected the handler error, got %d and %v", state, err)
+	}
+	if poller.Sequence() != 3 {
+		t.Fatalf("Expected the barrier to stop at the failed event, got %d", poller.Sequence())
+	}
+	if state, err := poller.Poll(h); state != PollProcessing || err != nil || len(handled) != 4 {
+		t.Fatalf("Expected the rest processed, got %d, %v and %v", state, err, handled)
+	}
+	if state, err := poller.Poll(h); state != PollIdle || err != nil {
+		t.Fatalf("Expected idle, got %d and %v", state, err)
+	}
+	for i, seq := range handled {
+		if seq != int64(i) {
+			t.Errorf("Expected event %d, got %d", i, seq)
+		}
+	}
+}
+
+// The same with Type 2 nodes:
+// 1 SimpleNode => 2 SimpleNode => 1 NodeBarrierPoller => back to the publisher
+func TestNodeBarrierPoller(t *testing.T) {
+	var handled []int64
+	h := HandlerFunc(func(seq int64, endOfBatch bool) error {
+		handled = append(handled, seq)
+		return nil
+	})
+
+	// Build the components
+	publisher := NewSimpleNode(true, 8)
+	consumer1 := NewSimpleNode(false, 8)
+	consumer2 := NewSimpleNode(false, 8)
+	poller := NewNodeBarrierPoller(NewNodeBarrier(8), publisher)
+
+	// Link the commit rings together.
+	consumer1.SetDependency(publisher.Committed())
+	consumer2.SetDependency(publisher.Committed())
+	poller.Barrier().AddDependency(consumer1.Committed())
+	poller.Barrier().AddDependency(consumer2.Committed())
+	publisher.SetDependency(poller.Barrier().Committed())
+
+	for lap := 0; lap < 3; lap++ {
+		for i := 0; i < 8; i++ {
+			publisher.Commit(publisher.Reserve())
+		}
+		if state, err := poller.Poll(h); state != PollGating || err != nil {
+			t.Fatalf("Expected gating, got %d and %v", state, err)
+		}
+		for i := 0; i < 8; i++ {
+			consumer1.Commit(consumer1.Reserve())
+		}
+		for i := 0; i < 5; i++ {
+			consumer2.Commit(consumer2.Reserve())
+		}
+		if state, err := poller.Poll(h); state != PollProcessing || err != nil || len(handled) != lap*8+5 {
+			t.Fatalf("Expected 5 processed, got %d, %v and %v", state, err, handled)
+		}
+		for i := 0; i < 3; i++ {
+			consumer2.Commit(consumer2.Reserve())
+		}
+		if state, err := poller.Poll(h); state != PollProcessing || err != nil || len(handled) != lap*8+8 {
+			t.Fatalf("Expected the rest processed, got %d, %v and %v", state, err, handled)
+		}
+		if state, err := poller.Poll(h); state != PollIdle || err != nil || poller.Sequence() != int64(lap*8+8) {
+			t.Fatalf("Expected idle at %d, got %d, %v and %d", lap*8+8, state, err, poller.Sequence())
+		}
+	}
+	for i, seq := range handled {
+		if seq != int64(i) {
+			t.Errorf("Expected cell %d, got %d", i, seq)
+		}
+	}
+}
+
+// Every kind of poller can be driven through the Poller interface.
+func TestPoller(t *testing.T) {
+	publisher1 := NewSimplePublishNode(8)
+	consumer1 := NewSimpleConsumeNode()
+	consumer1.SetDependency(publisher1.Committed())
+	publisher1.SetDependency(consumer1.Committed())
+
+	publisher2 := NewSimpleNode(true, 8)
+	consumer2 := NewSimpleNode(false, 8)
+	consumer2.SetDependency(publisher2.Committed())
+	publisher2.SetDependency(consumer2.Committed())
+
+	publisher3 := NewSimpleNode(true, 8)
+	consumer3 := NewMultiNode(false, 8)
+	consumer3.SetDependency(publisher3.Committed())
+	publisher3.SetDependency(consumer3.Committed())
+
+	publisher4 := NewSimplePublishNode(8)
+	barrier4 := NewConsumeBarrier()
+	barrier4.AddDependency(publisher4.Committed())
+	publisher4.SetDependency(barrier4.Committed())
+
+	publisher5 := NewSimpleNode(true, 8)
+	barrier5 := NewNodeBarrier(8)
+	barrier5.AddDependency(publisher5.Committed())
+	publisher5.SetDependency(barrier5.Committed())
+
+	for i := 0; i < 3; i++ {
+		publisher1.Reserve()
+		publisher1.Commit()
+		publisher2.Commit(publisher2.Reserve())
+		publisher3.Commit(publisher3.Reserve())
+		publisher4.Reserve()
+		publisher4.Commit()
+		publisher5.Commit(publisher5.Reserve())
+	}
+
+	pollers := []Poller{NewConsumePoller(consumer1, publisher1), NewNodePoller(consumer2, publisher2),
+		NewMultiPoller(consumer3, publisher3), NewBarrierPoller(barrier4, publisher4),
+		NewNodeBarrierPoller(barrier5, publisher5)}
+	for i, p := range pollers {
+		var handled int
+		h := HandlerFunc(func(seq int64, endOfBatch bool) error {
+			handled++
+			return nil
+		})
+		if state, err := p.Poll(h); state != PollProcessing || err != nil || handled != 3 {
+			t.Errorf("Poller %d: expected 3 processed, got %d, %v and %d", i, state, err, handled)
+		}
+		if state, err := p.Poll(h); state != PollIdle || err != nil || p.Sequence() != 3 {
+			t.Errorf("Poller %d: expected idle at 3, got %d, %v and %d", i, state, err, p.Sequence())
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package ringo
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Handler processes the events a processor reads from the ring.
+type Handler interface {
+	// OnEvent processes the event at seq. endOfBatch is true for the last event currently available,
+	// so a handler can flush work it has been gathering. Returning an error stops the processor with
+	// everything before seq committed.
+	OnEvent(seq int64, endOfBatch bool) error
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(seq int64, endOfBatch bool) error
+
+// OnEvent calls f(seq, endOfBatch).
+func (f HandlerFunc) OnEvent(seq int64, endOfBatch bool) error {
+	return f(seq, endOfBatch)
+}
+
+// TimeoutHandler is implemented by handlers that want to know when the stream goes quiet, to flush a
+// partial batch, send a heartbeat or check on something outside the ring.
+type TimeoutHandler interface {
+	// OnTimeout is called when no event has arrived for the processor's timeout. lastSeq is the
+	// last event processed, or one less than the first to come if there has been none. Returning an
+	// error stops the processor.
+	OnTimeout(lastSeq int64) error
+}
+
+// LifecycleHandler is implemented by handlers that open and close resources on the processor's own
+// go routine.
+type LifecycleHandler interface {
+	// OnStart is called as Run begins, before any event. Returning an error stops Run at once.
+	OnStart() error
+
+	// OnShutdown is called as Run returns, however it stops. Its error is returned by Run if there
+	// is no other.
+	OnShutdown() error
+}
+
+// SequenceReportingHandler is implemented by handlers that commit events before OnEvent returns,
+// so the stages behind them can reuse the cells sooner. This suits long running handlers that have
+// finished with the event data part way through their work.
+type SequenceReportingHandler interface {
+	// SetSequenceCallback is called by the factory function with a function that commits every
+	// event up to and including seq. It may only be called from OnEvent, with a seq no later than the
+	// event being processed.
+	SetSequenceCallback(commit func(seq int64))
+}
+
+// processor holds what consumeProcessor and nodeProcessor share: the handler, the run flag and the
+// pause state. A processor is paused only between batches, when everything it has read is committed,
+// so the ring backs up behind it and it picks up where it left off once resumed.
+type processor struct {
+	handler   Handler                    // Processes each event.
+	lifecycle LifecycleHandler           // The handler, if it opens and closes resources.
+	onTimeout TimeoutHandler             // The handler, if it wants to know when the stream goes quiet.
+	commit    func(from int64, to int64) // Marks events as processed in the node.
+	done      int64                      // The next event of the current batch to be committed.
+	end       int64                      // The end of the current batch.
+	timeout   time.Duration              // How long to wait for an event before calling onTimeout.
+	idleSince time.Time                  // When the Run loop last found nothing to process after a batch.
+	pause     int32                      // Set by Pause and cleared by Resume.
+	paused    int32                      // Set while the Run loop is parked.
+	pausedAt  int64                      // The sequence the Run loop is parked at.
+	running   bool                       // Is this processor chasing its dependency in a Run() loop?
+}
+
+// init sets up the processor for h, noting which optional interfaces it implements. commit marks
+// the events from up to but not including to as processed in the node.
+func (p *processor) init(h Handler, commit func(from int64, to int64)) {
+	p.handler = h
+	p.commit = commit
+	p.lifecycle, _ = h.(LifecycleHandler)
+	p.onTimeout, _ = h.(TimeoutHandler)
+	if r, ok := h.(SequenceReportingHandler); ok {
+		r.SetSequenceCallback(p.report)
+	}
+}
+
+// SetTimeout sets how long the Run loop waits for an event before calling OnTimeout, if the handler
+// is a TimeoutHandler. It is called again for each further d that passes without an event. Zero, the
+// default, never times out. It must be called before Run.
+func (p *processor) SetTimeout(d time.Duration) {
+	p.timeout = d
+}
+
+// Pause asks the Run loop to park at the next sequence boundary. It returns at once; use Paused to
+// find out when the processor has stopped.
+func (p *processor) Pause() {
+	atomic.StoreInt32(&p.pause, 1)
+}
+
+// Resume lets a paused Run loop carry on from where it parked.
+func (p *processor) Resume() {
+	atomic.StoreInt32(&p.pause, 0)
+}
+
+// Paused reports whether the Run loop is parked.
+func (p *processor) Paused() bool {
+	return atomic.LoadInt32(&p.paused) == 1
+}
+
+// PausedAt returns the sequence of the next event to be processed when the Run loop parked.
+func (p *processor) PausedAt() int64 {
+	return atomic.LoadInt64(&p.pausedAt)
+}
+
+// Stop breaks the loop cycle of the run, including while it is parked.
+func (p *processor) Stop() {
+	p.running = false
+}
+
+// Running returns the state of the running flag.
+func (p *processor) Running() bool {
+	return p.running
+}
+
+// start sets the running flag and calls OnStart. If it fails, the processor is not running.
+func (p *processor) start() error {
+	p.running = true
+	if p.lifecycle != nil {
+		if err := p.lifecycle.OnStart(); err != nil {
+			p.running = false
+			return err
+		}
+	}
+	return nil
+}
+
+// shutdown clears the running flag and calls OnShutdown, keeping err if there is one already.
+func (p *processor) shutdown(err *error) {
+	p.running = false
+	if p.lifecycle != nil {
+		if serr := p.lifecycle.OnShutdown(); *err == nil {
+			*err = serr
+		}
+	}
+}
+
+// park holds the Run loop at seq for as long as a pause is asked for.
+func (p *processor) park(seq int64) {
+	if atomic.LoadInt32(&p.pause) == 0 {
+		return
+	}
+	atomic.StoreInt64(&p.pausedAt, seq)
+	atomic.StoreInt32(&p.paused, 1)
+	for atomic.LoadInt32(&p.pause) == 1 && p.running {
+		time.Sleep(time.Millisecond)
+	}
+	atomic.StoreInt32(&p.paused, 0)
+}
+
+// idle is called each time the Run loop finds nothing to process, with next the sequence it is
+// waiting for. It calls OnTimeout once the timeout has passed and returns its error.
+func (p *processor) idle(next int64) error {
+	if p.timeout <= 0 || p.onTimeout == nil {
+		return nil
+	}
+	now := time.Now()
+	if p.idleSince.IsZero() {
+		p.idleSince = now
+		return nil
+	}
+	if now.Sub(p.idleSince) < p.timeout {
+		return nil
+	}
+	p.idleSince = now
+	return p.onTimeout.OnTimeout(next - 1)
+}
+
+// process hands the events from up to but not including to to the handler, then commits them.
+// If the handler fails or panics, only the events before the failed one are committed.
+func (p *processor) process(from int64, to int64) error {
+	p.idleSince = time.Time{}
+	p.done, p.end = from, to
+	seq := from
+	defer func() {
+		p.report(seq - 1)
+	}()
+	for ; seq < to; seq++ {
+		if err := p.handler.OnEvent(seq, seq == to-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// report commits the events of the current batch up to and including seq that are not already.
+func (p *processor) report(seq int64) {
+	if seq < p.done || seq >= p.end {
+		return
+	}
+	p.commit(p.done, seq+1)
+	p.done = seq + 1
+}
@@ -0,0 +1,415 @@
+package ringo
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The disruptor example with consumer 2 paused for maintenance, so the ring backs up behind it:
+// 1 SimplePublishNode => 2 ConsumeProcessors => 1 ConsumeBarrier => back to the publisher
+func TestConsumeProcessorPause(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := make([]int64, 32)
+	var sum1, sum2 int64
+
+	// Build the components
+	publisher := NewSimplePublishNode(32)
+	publisher.SetPolicy(PolicyFailFast)
+	consumer1 := NewConsumeProcessor(NewSimpleConsumeNode(), HandlerFunc(func(seq int64, end bool) error {
+		atomic.AddInt64(&sum1, ring[seq&31])
+		return nil
+	}))
+	consumer2 := NewConsumeProcessor(NewSimpleConsumeNode(), HandlerFunc(func(seq int64, end bool) error {
+		atomic.AddInt64(&sum2, ring[seq&31])
+		return nil
+	}))
+	barrier := NewConsumeBarrier()
+
+	// Link the committed counter dependencies together.
+	consumer1.Node().SetDependency(publisher.Committed())
+	consumer2.Node().SetDependency(publisher.Committed())
+	barrier.AddDependency(consumer1.Node().Committed())
+	barrier.AddDependency(consumer2.Node().Committed())
+	publisher.SetDependency(barrier.Committed())
+
+	go consumer1.Run()
+	go consumer2.Run()
+	go barrier.Run()
+
+	publish := func(n int) int {
+		for i := 0; i < n; i++ {
+			ndx, err := publisher.TryReserve()
+			if err != nil {
+				return i
+			}
+			ring[*ndx&31] = *ndx
+			publisher.Commit()
+		}
+		return n
+	}
+
+	publish(16)
+	for consumer2.Sequence() < 16 {
+		runtime.Gosched()
+	}
+	consumer2.Pause()
+	for !consumer2.Paused() {
+		runtime.Gosched()
+	}
+	if consumer2.PausedAt() != 16 {
+		t.Errorf("Expected consumer 2 to pause at 16, got %d", consumer2.PausedAt())
+	}
+
+	// Consumer 1 keeps up while the ring fills behind consumer 2.
+	for publisher.Sequence()-barrier.Sequence() < 32 {
+		if publish(1) == 0 {
+			runtime.Gosched()
+		}
+	}
+	if publish(1) != 0 || consumer2.Sequence() != 16 {
+		t.Fatalf("Expected a full ring with consumer 2 at 16, got %d", consumer2.Sequence())
+	}
+
+	consumer2.Resume()
+	for published := publisher.Sequence(); published < 100; published = publisher.Sequence() {
+		if publish(int(100-published)) == 0 {
+			runtime.Gosched()
+		}
+	}
+	for barrier.Sequence() < 100 {
+		runtime.Gosched()
+	}
+	consumer1.Stop()
+	consumer2.Stop()
+	barrier.Stop()
+
+	if consumer2.Paused() {
+		t.Error("Expected consumer 2 to be running")
+	}
+	if sum1 != 100*99/2 || sum2 != 100*99/2 {
+		t.Errorf("Expected sums of %d, got %d and %d", 100*99/2, sum1, sum2)
+	}
+}
+
+// The same with Type 2 nodes:
+// 1 SimpleNode => 2 NodeProcessors => 1 NodeBarrier => back to the publisher
+func TestNodeProcessorPause(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := make([]int64, 32)
+	var sum1, sum2 int64
+
+	// Build the components
+	publisher := NewSimpleNode(true, 32)
+	publisher.SetPolicy(PolicyFailFast)
+	consumer1 := NewNodeProcessor(NewSimpleNode(false, 32), HandlerFunc(func(seq int64, end bool) error {
+		atomic.AddInt64(&sum1, ring[seq&31])
+		return nil
+	}))
+	consumer2 := NewNodeProcessor(NewSimpleNode(false, 32), HandlerFunc(func(seq int64, end bool) error {
+		atomic.AddInt64(&sum2, ring[seq&31])
+		return nil
+	}))
+	barrier := NewNodeBarrier(32)
+
+	// Link the committed counter dependencies together.
+	consumer1.Node().SetDependency(publisher.Committed())
+	consumer2.Node().SetDependency(publisher.Committed())
+	barrier.AddDependency(consumer1.Node().Committed())
+	barrier.AddDependency(consumer2.Node().Committed())
+	publisher.SetDependency(barrier.Committed())
+
+	go consumer1.Run()
+	go consumer2.Run()
+	go barrier.Run()
+
+	publish := func(n int64) {
+		for i := int64(0); i < n; i++ {
+			ndx := publisher.Reserve()
+			ring[ndx&31] = ndx
+			publisher.Commit(ndx)
+		}
+	}
+
+	publish(16)
+	for consumer2.Sequence() < 16 {
+		runtime.Gosched()
+	}
+	consumer2.Pause()
+	for !consumer2.Paused() {
+		runtime.Gosched()
+	}
+	if consumer2.PausedAt() != 16 {
+		t.Errorf("Expected consumer 2 to pause at 16, got %d", consumer2.PausedAt())
+	}
+
+	// Once the ring is full behind consumer 2, the publisher is refused.
+	publish(32)
+	if _, err := publisher.TryReserve(); err != ErrFull {
+		t.Fatalf("Expected ErrFull, got %v", err)
+	}
+	for consumer1.Sequence() < 48 {
+		runtime.Gosched()
+	}
+	if consumer2.Sequence() != 16 {
+		t.Errorf("Expected consumer 2 at 16, got %d", consumer2.Sequence())
+	}
+
+	consumer2.Resume()
+	publish(52)
+	for barrier.Sequence() < 100 {
+		runtime.Gosched()
+	}
+	consumer1.Stop()
+	consumer2.Stop()
+	barrier.Stop()
+
+	if sum1 != 100*99/2 || sum2 != 100*99/2 {
+		t.Errorf("Expected sums of %d, got %d and %d", 100*99/2, sum1, sum2)
+	}
+}
+
+// batcher gathers events and flushes them four at a time, or sooner when the stream goes quiet.
+type batcher struct {
+	ring    []int64
+	batch   []int64
+	flushed chan []int64
+	lastSeq int64
+}
+
+func (b *batcher) OnEvent(seq int64, endOfBatch bool) error {
+	b.batch = append(b.batch, b.ring[seq&31])
+	if len(b.batch) == 4 {
+		b.flush()
+	}
+	return nil
+}
+
+func (b *batcher) OnTimeout(lastSeq int64) error {
+	b.lastSeq = lastSeq
+	if len(b.batch) > 0 {
+		b.flush()
+	}
+	return nil
+}
+
+func (b *batcher) flush() {
+	b.flushed <- b.batch
+	b.batch = nil
+}
+
+// A batching consumer flushes its partial batch once the publisher goes quiet:
+// 1 SimplePublishNode => 1 ConsumeProcessor
+func TestProcessorTimeout(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	b := &batcher{ring: make([]int64, 32), flushed: make(chan []int64, 4)}
+
+	// Build the components
+	publisher := NewSimplePublishNode(32)
+	consumer := NewConsumeProcessor(NewSimpleConsumeNode(), b)
+	consumer.SetTimeout(10 * time.Millisecond)
+
+	// Link the committed counter dependencies together.
+	consumer.Node().SetDependency(publisher.Committed())
+	publisher.SetDependency(consumer.Node().Committed())
+
+	result := make(chan error)
+	go func() {
+		result <- consumer.Run()
+	}()
+
+	for i := int64(0); i < 6; i++ {
+		ndx := *publisher.Reserve()
+		b.ring[ndx&31] = ndx * 10
+		publisher.Commit()
+	}
+
+	if batch := <-b.flushed; len(batch) != 4 || batch[3] != 30 {
+		t.Errorf("Expected a full batch, got %v", batch)
+	}
+	start := time.Now()
+	select {
+	case batch := <-b.flushed:
+		if len(batch) != 2 || batch[1] != 50 {
+			t.Errorf("Expected a partial batch, got %v", batch)
+		}
+		if time.Since(start) < 5*time.Millisecond {
+			t.Errorf("Expected the partial batch after the timeout, got it after %s", time.Since(start))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the partial batch to be flushed on timeout")
+	}
+	consumer.Stop()
+	if err := <-result; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if b.lastSeq != 5 {
+		t.Errorf("Expected the timeout after 5, got %d", b.lastSeq)
+	}
+}
+
+// A timeout error stops a Type 2 processor that has seen no events.
+func TestNodeProcessorTimeout(t *testing.T) {
+	errQuiet := errors.New("quiet")
+	var lastSeq int64
+
+	publisher := NewSimpleNode(true, 32)
+	consumer := NewNodeProcessor(NewSimpleNode(false, 32), &timeoutFunc{
+		Handler: HandlerFunc(func(int64, bool) error { return nil }),
+		fn: func(seq int64) error {
+			lastSeq = seq
+			return errQuiet
+		},
+	})
+	consumer.SetTimeout(time.Millisecond)
+	consumer.Node().SetDependency(publisher.Committed())
+
+	if err := consumer.Run(); err != errQuiet {
+		t.Fatalf("Expected the timeout error, got %v", err)
+	}
+	if lastSeq != -1 || consumer.Running() {
+		t.Errorf("Expected a stopped processor timed out at -1, got %d", lastSeq)
+	}
+}
+
+// timeoutFunc adds OnTimeout to a Handler.
+type timeoutFunc struct {
+	Handler
+	fn func(lastSeq int64) error
+}
+
+func (t *timeoutFunc) OnTimeout(lastSeq int64) error {
+	return t.fn(lastSeq)
+}
+
+// resourceHandler opens a resource on start, closes it on shutdown and commits each event as soon
+// as it has read it, before finishing the slow part of its work.
+type resourceHandler struct {
+	events   []string
+	commit   func(seq int64)
+	slow     chan bool // Closed to let the slow work on event 0 finish.
+	shutdown error
+}
+
+func (r *resourceHandler) OnStart() error {
+	r.events = append(r.events, "start")
+	return nil
+}
+
+func (r *resourceHandler) OnShutdown() error {
+	r.events = append(r.events, "shutdown")
+	return r.shutdown
+}
+
+func (r *resourceHandler) SetSequenceCallback(commit func(seq int64)) {
+	r.commit = commit
+}
+
+func (r *resourceHandler) OnEvent(seq int64, endOfBatch bool) error {
+	r.events = append(r.events, "event")
+	if seq == 0 {
+		r.commit(seq)
+		select {
+		case <-r.slow:
+		case <-time.After(time.Second):
+			return errors.New("event 0 was not committed early")
+		}
+	}
+	return nil
+}
+
+// A handler that commits event 0 early lets the publisher reuse its cell while still working on it,
+// with both node types: 1 Publisher => 1 Processor => back to the publisher on a ring of 4
+func TestProcessorLifecycle(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	errClose := errors.New("close failed")
+	for _, nodeType := range []string{"Type 1", "Type 2"} {
+		h := &resourceHandler{slow: make(chan bool), shutdown: errClose}
+		var consumer interface {
+			Runner
+			Sequence() int64
+		}
+		var publish func()
+
+		// Build and link the components.
+		if nodeType == "Type 1" {
+			publisher := NewSimplePublishNode(4)
+			c := NewConsumeProcessor(NewSimpleConsumeNode(), h)
+			c.Node().SetDependency(publisher.Committed())
+			publisher.SetDependency(c.Node().Committed())
+			consumer = c
+			publish = func() {
+				publisher.Reserve()
+				publisher.Commit()
+			}
+		} else {
+			publisher := NewSimpleNode(true, 4)
+			c := NewNodeProcessor(NewSimpleNode(false, 4), h)
+			c.Node().SetDependency(publisher.Committed())
+			publisher.SetDependency(c.Node().Committed())
+			consumer = c
+			publish = func() {
+				publisher.Commit(publisher.Reserve())
+			}
+		}
+
+		result := make(chan error)
+		go func() {
+			result <- consumer.Run()
+		}()
+
+		// The fifth event needs the cell of event 0.
+		for i := 0; i < 5; i++ {
+			publish()
+		}
+		close(h.slow)
+		for consumer.Sequence() < 5 {
+			runtime.Gosched()
+		}
+		consumer.Stop()
+		if err := <-result; err != errClose {
+			t.Fatalf("%s: Expected the shutdown error, got %v", nodeType, err)
+		}
+		if len(h.events) != 7 || h.events[0] != "start" || h.events[6] != "shutdown" {
+			t.Errorf("%s: Unexpected calls: %v", nodeType, h.events)
+		}
+	}
+
+	// A processor that fails to start processes nothing.
+	errOpen := errors.New("open failed")
+	consumer := NewConsumeProcessor(NewSimpleConsumeNode(), &startFailer{err: errOpen})
+	if err := consumer.Run(); err != errOpen || consumer.Running() {
+		t.Errorf("Expected a stopped processor and the start error, got %v", err)
+	}
+}
+
+// startFailer is a handler whose OnStart fails.
+type startFailer struct {
+	err error
+}
+
+func (s *startFailer) OnStart() error {
+	return s.err
+}
+
+func (s *startFailer) OnShutdown() error {
+	return nil
+}
+
+func (s *startFailer) OnEvent(int64, bool) error {
+	return errors.New("unexpected event")
+}
@@ -0,0 +1,223 @@
+package ringo
+
+import (
+	"runtime"
+	"testing"
+)
+
+// Barriers of each kind over three replicas at fixed positions.
+func TestQuorumBarrierType1(t *testing.T) {
+	replicas := []int64{5, 9, 7}
+	for _, test := range []struct {
+		barrier  *consumeBarrier
+		expected int64
+	}{
+		{NewConsumeBarrier(), 5},
+		{NewAnyOfBarrier(), 9},
+		{NewQuorumBarrier(2), 7},
+		{NewQuorumBarrier(3), 5},
+	} {
+		for i := range replicas {
+			test.barrier.AddDependency(&replicas[i])
+		}
+		go test.barrier.Run()
+		for test.barrier.Sequence() != test.expected {
+			runtime.Gosched()
+		}
+		test.barrier.Stop()
+	}
+
+	// Too few dependencies for the quorum holds the barrier where it is.
+	b := NewQuorumBarrier(4)
+	for i := range replicas {
+		b.AddDependency(&replicas[i])
+	}
+	values := []int64{}
+	if _, ok := b.agreed(&values); ok {
+		t.Error("Expected no agreement with 3 of 4 dependencies")
+	}
+}
+
+// The same for status rings.
+func TestQuorumBarrierType2(t *testing.T) {
+	replicas := []*simpleNode{NewSimpleNode(false, 32), NewSimpleNode(false, 32), NewSimpleNode(false, 32)}
+	replicas[0].SetSequence(5)
+	replicas[1].SetSequence(9)
+	replicas[2].SetSequence(7)
+	for _, test := range []struct {
+		barrier  *nodeBarrier
+		expected int64
+	}{
+		{NewNodeBarrier(32), 5},
+		{NewAnyOfNodeBarrier(32), 9},
+		{NewQuorumNodeBarrier(32, 2), 7},
+		{NewQuorumNodeBarrier(32, 3), 5},
+	} {
+		for _, r := range replicas {
+			test.barrier.AddDependency(r.Committed())
+		}
+		go test.barrier.Run()
+		for test.barrier.Sequence() != test.expected {
+			runtime.Gosched()
+		}
+		if test.barrier.ready(test.expected) {
+			t.Errorf("Expected cell %d not to be ready", test.expected)
+		}
+		test.barrier.Stop()
+	}
+}
+
+// Three replicas, one of which stalls, with a downstream consumer gated by a composite barrier. The
+// publisher stays gated by an all-of barrier over every replica and the consumer:
+// 1 MultiPublishNode => 3 SimpleConsumeNode => AnyOf + Quorum(2) => Barrier => 1 SimpleConsumeNode
+func TestCompositeBarrierType1(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	// Build the components
+	publisher := NewMultiPublishNode(32)
+	replicas := []*simpleConsumeNode{NewSimpleConsumeNode(), NewSimpleConsumeNode(), NewSimpleConsumeNode()}
+	anyOf := NewAnyOfBarrier()
+	quorum := NewQuorumBarrier(2)
+	barrier := NewConsumeBarrier()
+	consumer := NewSimpleConsumeNode()
+	gate := NewConsumeBarrier()
+
+	// Link the committed counter dependencies together.
+	for _, r := range replicas {
+		r.SetDependency(publisher.Committed())
+		anyOf.AddDependency(r.Committed())
+		quorum.AddDependency(r.Committed())
+		gate.AddDependency(r.Committed())
+	}
+	barrier.AddDependency(anyOf.Committed())
+	barrier.AddDependency(quorum.Committed())
+	consumer.SetDependency(barrier.Committed())
+	gate.AddDependency(consumer.Committed())
+	publisher.SetDependency(gate.Committed())
+
+	// The last replica stalls after 100 events until released.
+	release := make(chan struct{})
+	for n, r := range replicas {
+		go func(r *simpleConsumeNode, stall int) {
+			for i := 0; i < 1000; i++ {
+				if i == stall {
+					<-release
+				}
+				r.Reserve()
+				r.Commit()
+			}
+		}(r, []int{-1, -1, 100}[n])
+	}
+	go func() {
+		for i := 0; i < 1000; i++ {
+			consumer.Reserve()
+			consumer.Commit()
+		}
+	}()
+
+	for _, b := range []*consumeBarrier{anyOf, quorum, barrier, gate} {
+		go b.Run()
+	}
+
+	// The consumer passes the stalled replica, which holds the publisher back within a lap of it.
+	for i := int64(0); i < 120; i++ {
+		publisher.Reserve()
+		publisher.Commit()
+	}
+	for consumer.Sequence() < 120 {
+		runtime.Gosched()
+	}
+	if replicas[2].Sequence() != 100 {
+		t.Errorf("Expected the stalled replica at 100, got %d", replicas[2].Sequence())
+	}
+	close(release)
+	for i := int64(120); i < 1000; i++ {
+		publisher.Reserve()
+		publisher.Commit()
+	}
+	for consumer.Sequence() < 1000 || replicas[2].Sequence() < 1000 {
+		runtime.Gosched()
+	}
+	for _, b := range []*consumeBarrier{anyOf, quorum, barrier, gate} {
+		b.Stop()
+	}
+}
+
+// The same with status rings:
+// 1 SimpleNode => 3 SimpleNode => AnyOf + Quorum(2) => NodeBarrier => 1 SimpleNode
+func TestCompositeBarrierType2(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	// Build the components
+	publisher := NewSimpleNode(true, 32)
+	replicas := []*simpleNode{NewSimpleNode(false, 32), NewSimpleNode(false, 32), NewSimpleNode(false, 32)}
+	anyOf := NewAnyOfNodeBarrier(32)
+	quorum := NewQuorumNodeBarrier(32, 2)
+	barrier := NewNodeBarrier(32)
+	consumer := NewSimpleNode(false, 32)
+	gate := NewNodeBarrier(32)
+
+	// Link the committed counter dependencies together.
+	for _, r := range replicas {
+		r.SetDependency(publisher.Committed())
+		anyOf.AddDependency(r.Committed())
+		quorum.AddDependency(r.Committed())
+		gate.AddDependency(r.Committed())
+	}
+	barrier.AddDependency(anyOf.Committed())
+	barrier.AddDependency(quorum.Committed())
+	consumer.SetDependency(barrier.Committed())
+	gate.AddDependency(consumer.Committed())
+	publisher.SetDependency(gate.Committed())
+
+	// The last replica stalls after 100 events until released.
+	release := make(chan struct{})
+	for n, r := range replicas {
+		go func(r *simpleNode, stall int) {
+			for i := 0; i < 1000; i++ {
+				if i == stall {
+					<-release
+				}
+				ndx := r.Reserve()
+				r.Commit(ndx)
+			}
+		}(r, []int{-1, -1, 100}[n])
+	}
+	go func() {
+		for i := 0; i < 1000; i++ {
+			ndx := consumer.Reserve()
+			consumer.Commit(ndx)
+		}
+	}()
+
+	for _, b := range []*nodeBarrier{anyOf, quorum, barrier, gate} {
+		go b.Run()
+	}
+
+	// The consumer passes the stalled replica, which holds the publisher back within a lap of it.
+	for i := int64(0); i < 120; i++ {
+		ndx := publisher.Reserve()
+		publisher.Commit(ndx)
+	}
+	for consumer.Sequence() < 120 {
+		runtime.Gosched()
+	}
+	if replicas[2].Sequence() != 100 {
+		t.Errorf("Expected the stalled replica at 100, got %d", replicas[2].Sequence())
+	}
+	close(release)
+	for i := int64(120); i < 1000; i++ {
+		ndx := publisher.Reserve()
+		publisher.Commit(ndx)
+	}
+	for consumer.Sequence() < 1000 || replicas[2].Sequence() < 1000 {
+		runtime.Gosched()
+	}
+	for _, b := range []*nodeBarrier{anyOf, quorum, barrier, gate} {
+		b.Stop()
+	}
+}
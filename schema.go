@@ -0,0 +1,224 @@
+package ringo
+
+import "fmt"
+
+// schema stores the fields of the events in a ring as parallel columns, each indexed by seq&mask,
+// instead of as a ring of pointers to structs. A consumer that only reads a couple of fields of a
+// wide event then only pulls those columns through the cache, and walks them sequentially.
+// Columns are declared with Declare while the ring is being built, before any go routine uses it.
+// Each consumer then looks up the columns it reads with Column, by the same name and kind. Looking up
+// an unknown name or the wrong kind panics, as that is a programming error, and as lookups never
+// change the schema any number of go routines can make them.
+type schema struct {
+	mask    int64              // Used in place of modulo for index calculations.
+	names   []string           // Names of the columns, in the order declared.
+	columns map[string]*column // The columns by name.
+}
+
+// ColumnKind is the type of the values held in a column.
+type ColumnKind int
+
+const (
+	ColumnInt64 ColumnKind = iota
+	ColumnInt32
+	ColumnUint64
+	ColumnFloat64
+	ColumnBool
+)
+
+// columnKinds holds the name of each kind of column.
+var columnKinds = [...]string{
+	ColumnInt64:   "int64",
+	ColumnInt32:   "int32",
+	ColumnUint64:  "uint64",
+	ColumnFloat64: "float64",
+	ColumnBool:    "bool",
+}
+
+// String returns the name of the kind.
+func (k ColumnKind) String() string {
+	return columnKinds[k]
+}
+
+// NewSchema is a factory function that returns a new schema for a ring of size, a power of two.
+func NewSchema(size int64) *schema {
+	return &schema{
+		mask:    size - 1,
+		columns: make(map[string]*column),
+	}
+}
+
+// Declare adds a column called name holding values of kind, and returns it. It panics if the name is
+// already declared.
+func (s *schema) Declare(name string, kind ColumnKind) *column {
+	if _, ok := s.columns[name]; ok {
+		panic(fmt.Sprintf("ringo: column %q is already declared", name))
+	}
+	size := s.mask + 1
+	c := &column{kind: kind, mask: s.mask}
+	switch kind {
+	case ColumnInt64:
+		c.int64s = make([]int64, size)
+	case ColumnInt32:
+		c.int32s = make([]int32, size)
+	case ColumnUint64:
+		c.uint64s = make([]uint64, size)
+	case ColumnFloat64:
+		c.float64s = make([]float64, size)
+	case ColumnBool:
+		c.bools = make([]bool, size)
+	default:
+		panic(fmt.Sprintf("ringo: column %q has unknown kind %d", name, int(kind)))
+	}
+	s.columns[name] = c
+	s.names = append(s.names, name)
+	return c
+}
+
+// Column returns the column called name. It panics if no such column was declared, or if it holds a
+// different kind.
+func (s *schema) Column(name string, kind ColumnKind) *column {
+	c, ok := s.columns[name]
+	if !ok {
+		panic(fmt.Sprintf("ringo: column %q is not declared", name))
+	}
+	if c.kind != kind {
+		panic(fmt.Sprintf("ringo: column %q is %s, not %s", name, c.kind, kind))
+	}
+	return c
+}
+
+// Columns returns the names of the columns, in the order they were declared.
+func (s *schema) Columns() []string {
+	return s.names
+}
+
+// Reset zeroes every column for index, so the slot can be reused.
+func (s *schema) Reset(index int64) {
+	for _, name := range s.names {
+		s.columns[name].reset(index)
+	}
+}
+
+// column holds the values of one field for every cell in the ring. Every kind shares this one
+// implementation, with the values kept in the typed slice for the kind and the slices for the other
+// kinds left empty. Using an accessor of the wrong kind therefore panics in every build: reading or
+// storing a value indexes an empty slice, and the whole column views check the kind.
+type column struct {
+	kind     ColumnKind // The type of the values.
+	mask     int64      // Used in place of modulo for index calculations.
+	int64s   []int64    // The values of an int64 column, one per cell in the ring.
+	int32s   []int32    // The values of an int32 column.
+	uint64s  []uint64   // The values of a uint64 column.
+	float64s []float64  // The values of a float64 column.
+	bools    []bool     // The values of a bool column.
+}
+
+// Kind returns the type of the values held in the column.
+func (c *column) Kind() ColumnKind {
+	return c.kind
+}
+
+// check panics if the column does not hold values of kind.
+func (c *column) check(kind ColumnKind) {
+	if c.kind != kind {
+		panic(fmt.Sprintf("ringo: column is %s, not %s", c.kind, kind))
+	}
+}
+
+// reset zeroes the value for index.
+func (c *column) reset(index int64) {
+	index &= c.mask
+	switch c.kind {
+	case ColumnInt64:
+		c.int64s[index] = 0
+	case ColumnInt32:
+		c.int32s[index] = 0
+	case ColumnUint64:
+		c.uint64s[index] = 0
+	case ColumnFloat64:
+		c.float64s[index] = 0
+	case ColumnBool:
+		c.bools[index] = false
+	}
+}
+
+// Int64 returns the value for index in an int64 column.
+func (c *column) Int64(index int64) int64 {
+	return c.int64s[index&c.mask]
+}
+
+// SetInt64 stores the value for index in an int64 column.
+func (c *column) SetInt64(index int64, v int64) {
+	c.int64s[index&c.mask] = v
+}
+
+// Int64s returns the whole of an int64 column, for walking a batch found with Segments.
+func (c *column) Int64s() []int64 {
+	c.check(ColumnInt64)
+	return c.int64s
+}
+
+// Int32 returns the value for index in an int32 column.
+func (c *column) Int32(index int64) int32 {
+	return c.int32s[index&c.mask]
+}
+
+// SetInt32 stores the value for index in an int32 column.
+func (c *column) SetInt32(index int64, v int32) {
+	c.int32s[index&c.mask] = v
+}
+
+// Int32s returns the whole of an int32 column, for walking a batch found with Segments.
+func (c *column) Int32s() []int32 {
+	c.check(ColumnInt32)
+	return c.int32s
+}
+
+// Uint64 returns the value for index in a uint64 column.
+func (c *column) Uint64(index int64) uint64 {
+	return c.uint64s[index&c.mask]
+}
+
+// SetUint64 stores the value for index in a uint64 column.
+func (c *column) SetUint64(index int64, v uint64) {
+	c.uint64s[index&c.mask] = v
+}
+
+// Uint64s returns the whole of a uint64 column, for walking a batch found with Segments.
+func (c *column) Uint64s() []uint64 {
+	c.check(ColumnUint64)
+	return c.uint64s
+}
+
+// Float64 returns the value for index in a float64 column.
+func (c *column) Float64(index int64) float64 {
+	return c.float64s[index&c.mask]
+}
+
+// SetFloat64 stores the value for index in a float64 column.
+func (c *column) SetFloat64(index int64, v float64) {
+	c.float64s[index&c.mask] = v
+}
+
+// Float64s returns the whole of a float64 column, for walking a batch found with Segments.
+func (c *column) Float64s() []float64 {
+	c.check(ColumnFloat64)
+	return c.float64s
+}
+
+// Bool returns the value for index in a bool column.
+func (c *column) Bool(index int64) bool {
+	return c.bools[index&c.mask]
+}
+
+// SetBool stores the value for index in a bool column.
+func (c *column) SetBool(index int64, v bool) {
+	c.bools[index&c.mask] = v
+}
+
+// Bools returns the whole of a bool column, for walking a batch found with Segments.
+func (c *column) Bools() []bool {
+	c.check(ColumnBool)
+	return c.bools
+}
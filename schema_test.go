@@ -0,0 +1,214 @@
+package ringo
+
+import (
+	"runtime"
+	"testing"
+)
+
+// wideEvent is an event with more fields than any one consumer reads.
+type wideEvent struct {
+	id       int64
+	price    float64
+	quantity int64
+	account  int64
+	venue    int64
+	time     int64
+	flags    int64
+	checksum int64
+}
+
+// Two consumers reading different columns of the same events:
+// 1 SimplePublishNode => 2 SimpleConsumeNode => Barrier
+func TestSchema(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	// Declare the schema.
+	events := NewSchema(32)
+	id := events.Declare("id", ColumnInt64)
+	price := events.Declare("price", ColumnFloat64)
+	side := events.Declare("side", ColumnInt32)
+	buy := events.Declare("buy", ColumnBool)
+	account := events.Declare("account", ColumnUint64)
+
+	// Build the components
+	publisher := NewSimplePublishNode(32)
+	consumer1 := NewSimpleConsumeNode()
+	consumer2 := NewSimpleConsumeNode()
+	barrier := NewConsumeBarrier()
+
+	// Link the committed counter dependencies together.
+	consumer1.SetDependency(publisher.Committed())
+	consumer2.SetDependency(publisher.Committed())
+	barrier.AddDependency(consumer1.Committed())
+	barrier.AddDependency(consumer2.Committed())
+	publisher.SetDependency(barrier.Committed())
+
+	done := make(chan bool)
+
+	// Consumer 1 only reads prices.
+	go func() {
+		prices := events.Column("price", ColumnFloat64)
+		for i := int64(0); i < 256; i++ {
+			ndx := *consumer1.Reserve()
+			if prices.Float64(ndx) != float64(i)/2 {
+				t.Errorf("Expected price %f, got %f", float64(i)/2, prices.Float64(ndx))
+			}
+			consumer1.Commit()
+		}
+		done <- true
+	}()
+
+	// Consumer 2 only reads sides and accounts.
+	go func() {
+		sides, accounts := events.Column("side", ColumnInt32), events.Column("account", ColumnUint64)
+		for i := int64(0); i < 256; i++ {
+			ndx := *consumer2.Reserve()
+			if sides.Int32(ndx) != int32(i%2) || accounts.Uint64(ndx) != uint64(i)*3 {
+				t.Errorf("Unexpected side %d or account %d at %d", sides.Int32(ndx), accounts.Uint64(ndx), i)
+			}
+			consumer2.Commit()
+		}
+		done <- true
+	}()
+
+	go func() {
+		barrier.Run()
+	}()
+
+	for i := int64(0); i < 256; i++ {
+		ndx := *publisher.Reserve()
+		id.SetInt64(ndx, i)
+		price.SetFloat64(ndx, float64(i)/2)
+		side.SetInt32(ndx, int32(i%2))
+		buy.SetBool(ndx, i%2 == 0)
+		account.SetUint64(ndx, uint64(i)*3)
+		publisher.Commit()
+	}
+	<-done
+	<-done
+	barrier.Stop()
+
+	if got := events.Columns(); len(got) != 5 || got[0] != "id" || got[4] != "account" {
+		t.Errorf("Unexpected columns %v", got)
+	}
+	if id.Int64(255) != 255 || !buy.Bool(254) || len(id.Int64s()) != 32 || len(buy.Bools()) != 32 {
+		t.Errorf("Unexpected final values")
+	}
+	events.Reset(255)
+	if id.Int64(255) != 0 || price.Float64(255) != 0 || buy.Bool(255) || side.Int32(255) != 0 ||
+		account.Uint64(255) != 0 || id.Int64(254) != 254 || side.Int32(254) != 0 || side.Int32(253) != 1 {
+		t.Errorf("Expected only cell 255 to be reset")
+	}
+}
+
+// Looking up a column that was never declared, or as the wrong kind, and declaring one twice are
+// programming errors.
+func TestSchemaMisuse(t *testing.T) {
+	events := NewSchema(8)
+	events.Declare("id", ColumnInt64)
+	tests := []struct {
+		name string
+		call func()
+	}{
+		{"unknown", func() { events.Column("idd", ColumnInt64) }},
+		{"mismatch", func() { events.Column("id", ColumnFloat64) }},
+		{"redeclared", func() { events.Declare("id", ColumnBool) }},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for %s", test.name)
+				}
+			}()
+			test.call()
+		}()
+	}
+	if got := events.Columns(); len(got) != 1 {
+		t.Errorf("Expected the misuse to leave one column, got %v", got)
+	}
+}
+
+// Reading, storing or viewing a column through the accessors of another kind panics in every build,
+// not only under ringodebug, rather than reinterpreting the memory of the column.
+func TestSchemaAccessorMismatch(t *testing.T) {
+	events := NewSchema(8)
+	id := events.Declare("id", ColumnInt64)
+	side := events.Declare("side", ColumnInt32)
+	buy := events.Declare("buy", ColumnBool)
+	tests := []struct {
+		name string
+		call func()
+	}{
+		{"Int32 of int64", func() { id.Int32(3) }},
+		{"SetFloat64 of int64", func() { id.SetFloat64(3, 1.5) }},
+		{"Int64 of int32", func() { side.Int64(3) }},
+		{"SetUint64 of bool", func() { buy.SetUint64(3, 1) }},
+		{"Int64s of bool", func() { buy.Int64s() }},
+		{"Bools of int32", func() { side.Bools() }},
+		{"Float64s of int64", func() { id.Float64s() }},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for %s", test.name)
+				}
+			}()
+			test.call()
+		}()
+	}
+	if id.Int64(3) != 0 || side.Int32(3) != 0 || buy.Bool(3) {
+		t.Errorf("Expected the mismatched accessors to leave the columns untouched")
+	}
+}
+
+// A consumer reading one field through the README layout, a ring of pointers to structs.
+func BenchmarkLayoutPointers(b *testing.B) {
+	ring := make([]*wideEvent, PT1Meg)
+	for i := range ring {
+		ring[i] = &wideEvent{quantity: int64(i)}
+	}
+	mask := int64(PT1Meg - 1)
+	var total int64
+	b.ResetTimer()
+	for i := int64(0); i < int64(b.N); i++ {
+		total += ring[i&mask].quantity
+	}
+	runtime.KeepAlive(total)
+}
+
+// A consumer reading one field from a ring of structs held by value.
+func BenchmarkLayoutStructs(b *testing.B) {
+	ring := make([]wideEvent, PT1Meg)
+	for i := range ring {
+		ring[i].quantity = int64(i)
+	}
+	mask := int64(PT1Meg - 1)
+	var total int64
+	b.ResetTimer()
+	for i := int64(0); i < int64(b.N); i++ {
+		total += ring[i&mask].quantity
+	}
+	runtime.KeepAlive(total)
+}
+
+// A consumer reading the same field as a column.
+func BenchmarkLayoutColumns(b *testing.B) {
+	events := NewSchema(PT1Meg)
+	for _, name := range []string{"id", "price", "quantity", "account", "venue", "time", "flags", "checksum"} {
+		events.Declare(name, ColumnInt64)
+	}
+	quantity := events.Column("quantity", ColumnInt64)
+	for i := int64(0); i < PT1Meg; i++ {
+		quantity.SetInt64(i, i)
+	}
+	var total int64
+	b.ResetTimer()
+	for i := int64(0); i < int64(b.N); i++ {
+		total += quantity.Int64(i)
+	}
+	runtime.KeepAlive(total)
+}
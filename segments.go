@@ -0,0 +1,35 @@
+package ringo
+
+// Segment is a contiguous run of physical cells in a ring, from Start up to but not including End.
+type Segment struct {
+	Start int64
+	End   int64
+}
+
+// Len returns the number of cells in the segment.
+func (s Segment) Len() int64 {
+	return s.End - s.Start
+}
+
+// Segments splits the sequences from up to but not including to into at most two contiguous runs of
+// cells in a ring of size. The head segment starts at from&mask. If the range crosses the physical end
+// of the ring, the tail segment holds the remainder starting at cell 0, otherwise it is empty.
+// For example, with ring []*MyWorkStruct:
+//
+//	head, tail := ringo.Segments(from, to, size)
+//	process(ring[head.Start:head.End])
+//	process(ring[tail.Start:tail.End])
+func Segments(from int64, to int64, size int64) (Segment, Segment) {
+	start := from & (size - 1)
+	if end := start + to - from; end <= size {
+		return Segment{start, end}, Segment{}
+	}
+	return Segment{start, size}, Segment{0, to - from - (size - start)}
+}
+
+// ByteSegments returns the bytes of a byte ring between positions from and to as at most two slices.
+// The slices refer directly to buf, so they can be handed to vectored writes such as net.Buffers.
+func ByteSegments(buf []byte, from int64, to int64) ([]byte, []byte) {
+	head, tail := Segments(from, to, int64(len(buf)))
+	return buf[head.Start:head.End], buf[tail.Start:tail.End]
+}
@@ -0,0 +1,154 @@
+package ringo
+
+import (
+	"encoding/binary"
+	"runtime"
+	"testing"
+)
+
+func TestSegments(t *testing.T) {
+	tests := []struct {
+		from, to   int64
+		head, tail Segment
+	}{
+		{0, 0, Segment{0, 0}, Segment{}},
+		{0, 8, Segment{0, 8}, Segment{}},
+		{3, 6, Segment{3, 6}, Segment{}},
+		{13, 16, Segment{5, 8}, Segment{}},
+		{6, 10, Segment{6, 8}, Segment{0, 2}},
+		{15, 23, Segment{7, 8}, Segment{0, 7}},
+	}
+	for _, tc := range tests {
+		head, tail := Segments(tc.from, tc.to, 8)
+		if head != tc.head || tail != tc.tail {
+			t.Errorf("Segments(%d, %d): expected %v %v, got %v %v.", tc.from, tc.to, tc.head, tc.tail, head, tail)
+		}
+		if head.Len()+tail.Len() != tc.to-tc.from {
+			t.Errorf("Segments(%d, %d): lengths do not cover the range.", tc.from, tc.to)
+		}
+	}
+
+	buf := []byte("abcdefgh")
+	head, tail := ByteSegments(buf, 14, 19)
+	if string(head) != "gh" || string(tail) != "abc" {
+		t.Errorf("ByteSegments: expected gh abc, got %s %s.", head, tail)
+	}
+}
+
+// A simple queue where the consumer reads in batches: Publisher <==> Consumer
+func TestSegmentsBatchType1(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := make([]int64, 32)
+	master := NewSimplePublishNode(32)
+	slave := NewSimpleConsumeNode()
+	master.SetDependency(slave.Committed())
+	slave.SetDependency(master.Committed())
+
+	done := make(chan bool)
+
+	go func() {
+		next := int64(0)
+		for next < 1024 {
+			from, to := slave.ReserveBatch()
+			head, tail := Segments(from, to, 32)
+			for _, seg := range []Segment{head, tail} {
+				for _, v := range ring[seg.Start:seg.End] {
+					if v != next {
+						t.Errorf("Expected %d, got %d.", next, v)
+					}
+					next++
+				}
+			}
+			slave.CommitBatch(to)
+		}
+		close(done)
+	}()
+
+	for i := int64(0); i < 1024; i++ {
+		index := master.Reserve()
+		ring[*index&31] = i
+		master.Commit()
+	}
+	<-done
+}
+
+// A simple queue where the consumer reads in batches: Publisher <==> Consumer
+func TestSegmentsBatchType2(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := make([]int64, 32)
+	master := NewSimpleNode(true, 32)
+	slave := NewSimpleNode(false, 32)
+	master.SetDependency(slave.Committed())
+	slave.SetDependency(master.Committed())
+
+	done := make(chan bool)
+
+	go func() {
+		next := int64(0)
+		for next < 1024 {
+			from, to := slave.ReserveBatch()
+			head, tail := Segments(from, to, 32)
+			for _, seg := range []Segment{head, tail} {
+				for _, v := range ring[seg.Start:seg.End] {
+					if v != next {
+						t.Errorf("Expected %d, got %d.", next, v)
+					}
+					next++
+				}
+			}
+			slave.CommitBatch(from, to)
+		}
+		close(done)
+	}()
+
+	for i := int64(0); i < 1024; i++ {
+		ndx := master.Reserve()
+		ring[ndx&31] = i
+		master.Commit(ndx)
+	}
+	<-done
+}
+
+// Raw record batches read from a message ring: Publisher <==> Consumer
+func TestSegmentsMessageRing(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := NewMessageRing(1024, false)
+	done := make(chan bool)
+
+	go func() {
+		next := uint64(0)
+		for next < 2048 {
+			head, tail := ring.ReadBatch()
+			for _, b := range [][]byte{head, tail} {
+				for len(b) > 0 {
+					length := int64(binary.LittleEndian.Uint32(b))
+					if int32(binary.LittleEndian.Uint32(b[4:])) != msgTypePadding {
+						if n := binary.LittleEndian.Uint64(b[msgHeaderLength:]); n != next {
+							t.Errorf("Expected message %d, got %d.", next, n)
+						}
+						next++
+					}
+					b = b[alignRecord(length):]
+				}
+			}
+			ring.ReleaseBatch(int64(len(head) + len(tail)))
+		}
+		close(done)
+	}()
+
+	msg := make([]byte, 24)
+	for i := uint64(0); i < 2048; i++ {
+		binary.LittleEndian.PutUint64(msg, i)
+		ring.Write(msg)
+	}
+	<-done
+}
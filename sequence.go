@@ -0,0 +1,49 @@
+package ringo
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// sequencer is implemented by every node, barrier and stage that tracks a position in the ring.
+// Sequence returns the next index it will process. Every index below it has been committed.
+type sequencer interface {
+	Sequence() int64
+}
+
+// stampRing initializes a Type 2 status ring so it reads as if every index below seq had been
+// committed. Each cell is stamped with the rotation of the last index below seq that maps to it.
+// For seq 0 this leaves every cell at initSeqValue, as the factory functions do.
+func stampRing(ring []int32, seq int64, shift uint8) {
+	mask := int64(len(ring) - 1)
+	for i := int64(0); i <= mask; i++ {
+		last := seq - 1 - ((seq - 1 - i) & mask)
+		ring[i] = int32(last >> shift)
+	}
+}
+
+// ringProgress returns the first index from up to but not including to whose cell in ring is not
+// stamped with its rotation, or to if every one is. A stage completes cells in order, so the stamped
+// cells come first and can be found with a binary search.
+func ringProgress(ring []int32, from int64, to int64, shift uint8) int64 {
+	if from < 0 {
+		from = 0
+	}
+	if to <= from {
+		return to
+	}
+	mask := int64(len(ring) - 1)
+	return from + int64(sort.Search(int(to-from), func(i int) bool {
+		index := from + int64(i)
+		return atomic.LoadInt32(&ring[index&mask]) != int32(index>>shift)
+	}))
+}
+
+// ringSequence returns the next index to be committed in a status ring whose owner has reserved up
+// to cursor. If the cell at cursor is stamped, everything up to it is done.
+func ringSequence(ring []int32, cursor int64, shift uint8) int64 {
+	if ring[cursor&int64(len(ring)-1)] != int32(cursor>>shift) {
+		return cursor
+	}
+	return cursor + 1
+}
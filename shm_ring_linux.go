@@ -0,0 +1,471 @@
+//go:build linux
+// +build linux
+
+package ringo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// A shared ring lives in a file mapped into the memory of every process using it, normally under
+// /dev/shm so it never touches a disk. The file starts with a header of cache lines, followed by the
+// slots:
+//
+//	line 0: magic uint32 | version uint32 | mode uint32 | slot size uint32 | slot count int64
+//	line 1: producer pid int32
+//	line 2: consumer pid int32
+//	line 3: claimed int64, the next index handed to an MPSC producer
+//	line 4: committed int64, the count of slots published
+//	line 5: consumed int64, the count of slots read
+//	line 6: producer heartbeat int64, unix nanoseconds
+//	line 7: consumer heartbeat int64, unix nanoseconds
+//
+// Each counter has a cache line to itself, in the same way as the cachepad fields of the Type 1 nodes.
+// Integers are in the byte order of the machine, as both processes share it.
+const (
+	shmMagic      uint32 = 0x4f474e52 // "RNGO"
+	shmVersion    uint32 = 2
+	shmLine              = 64
+	shmHeaderSize        = 8 * shmLine
+
+	shmVersionOffset   = 4
+	shmModeOffset      = 8
+	shmSlotSizeOffset  = 12
+	shmSlotCountOffset = 16
+	shmProducerOffset  = 1 * shmLine
+	shmConsumerOffset  = 2 * shmLine
+	shmClaimedOffset   = 3 * shmLine
+	shmCommittedOffset = 4 * shmLine
+	shmConsumedOffset  = 5 * shmLine
+	shmProducerBeat    = 6 * shmLine
+	shmConsumerBeat    = 7 * shmLine
+)
+
+// ShmMode selects how many producers may publish to a shared ring.
+type ShmMode uint32
+
+const (
+	// ShmSPSC allows a single producer process with a single go routine publishing.
+	ShmSPSC ShmMode = iota + 1
+
+	// ShmMPSC allows any number of producer processes and go routines. Slots are claimed with a
+	// compare and swap and published in index order.
+	ShmMPSC
+)
+
+var (
+	// ErrShmIncompatible is returned when attaching to a file that is not a shared ring of this version.
+	ErrShmIncompatible = errors.New("ringo: shared ring is missing or has an incompatible layout")
+
+	// ErrShmAttached is returned when the role being attached is held by another live process.
+	ErrShmAttached = errors.New("ringo: shared ring already attached by a live process")
+
+	// ErrPeerDead is returned when the process at the other end of a shared ring has stopped beating.
+	ErrPeerDead = errors.New("ringo: shared ring peer has stopped its heartbeat")
+)
+
+// shmPath returns the file for a shared ring. Plain names are placed in /dev/shm.
+func shmPath(name string) string {
+	if strings.ContainsRune(name, os.PathSeparator) {
+		return name
+	}
+	return filepath.Join("/dev/shm", name)
+}
+
+// CreateShmRing creates a shared ring called name with slotCount slots of slotSize bytes each.
+// slotCount must be a power of two and slotSize a multiple of 8. The call fails if the ring exists.
+func CreateShmRing(name string, mode ShmMode, slotSize int, slotCount int64) error {
+	if mode != ShmSPSC && mode != ShmMPSC {
+		return errors.New("ringo: unknown shared ring mode")
+	}
+	if slotSize <= 0 || slotSize%8 != 0 {
+		return errors.New("ringo: slot size must be a positive multiple of 8")
+	}
+	if slotCount <= 0 || slotCount&(slotCount-1) != 0 {
+		return errors.New("ringo: slot count must be a power of two")
+	}
+
+	path := shmPath(name)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	length := shmHeaderSize + int64(slotSize)*slotCount
+	if err := file.Truncate(length); err != nil {
+		os.Remove(path)
+		return err
+	}
+	mem, err := syscall.Mmap(int(file.Fd()), 0, int(length), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	// The magic number goes in last, so a process attaching meanwhile sees an incomplete ring.
+	*shmUint32(mem, shmVersionOffset) = shmVersion
+	*shmUint32(mem, shmModeOffset) = uint32(mode)
+	*shmUint32(mem, shmSlotSizeOffset) = uint32(slotSize)
+	*shmInt64(mem, shmSlotCountOffset) = slotCount
+	atomic.StoreUint32(shmUint32(mem, 0), shmMagic)
+	return syscall.Munmap(mem)
+}
+
+// RemoveShmRing deletes the shared ring called name. Processes still attached keep their mapping.
+func RemoveShmRing(name string) error {
+	return os.Remove(shmPath(name))
+}
+
+// shmUint32 returns a pointer to the uint32 at offset in a mapping.
+func shmUint32(mem []byte, offset int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&mem[offset]))
+}
+
+// shmInt32 returns a pointer to the int32 at offset in a mapping.
+func shmInt32(mem []byte, offset int) *int32 {
+	return (*int32)(unsafe.Pointer(&mem[offset]))
+}
+
+// shmInt64 returns a pointer to the int64 at offset in a mapping.
+func shmInt64(mem []byte, offset int) *int64 {
+	return (*int64)(unsafe.Pointer(&mem[offset]))
+}
+
+// shmAlive reports whether the process pid is still running.
+func shmAlive(pid int32) bool {
+	return syscall.Kill(int(pid), 0) != syscall.ESRCH
+}
+
+// shmMapping is the part of a shared ring common to producers and consumers.
+type shmMapping struct {
+	mem       []byte    // The mapped file.
+	mode      ShmMode   // How many producers may publish.
+	slotSize  int64     // Size of a slot in bytes.
+	mask      int64     // Used in place of modulo for index calculations.
+	size      int64     // Number of slots in the ring.
+	claimed   *int64    // Next index to be handed to an MPSC producer.
+	committed *int64    // Count of slots published.
+	consumed  *int64    // Count of slots read.
+	owner     *int32    // The pid word this handle holds, if its role is exclusive.
+	beat      *int64    // The heartbeat word of this handle's role.
+	peerBeat  *int64    // The heartbeat word of the other end.
+	timeout   int64     // Nanoseconds without a peer heartbeat before the peer is dead. Zero disables.
+	attached  int64     // When this handle attached, in unix nanoseconds.
+	stop      chan bool // Closed to end the StartHeartbeat go routine.
+	stopped   chan bool // Closed when the StartHeartbeat go routine has ended.
+}
+
+// attach maps the shared ring called name and validates its header.
+func (m *shmMapping) attach(name string) error {
+	file, err := os.OpenFile(shmPath(name), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < shmHeaderSize {
+		return ErrShmIncompatible
+	}
+	mem, err := syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+
+	slotSize := int64(*shmUint32(mem, shmSlotSizeOffset))
+	slotCount := *shmInt64(mem, shmSlotCountOffset)
+	if atomic.LoadUint32(shmUint32(mem, 0)) != shmMagic || *shmUint32(mem, shmVersionOffset) != shmVersion ||
+		info.Size() != shmHeaderSize+slotSize*slotCount {
+		syscall.Munmap(mem)
+		return ErrShmIncompatible
+	}
+	m.mem = mem
+	m.mode = ShmMode(*shmUint32(mem, shmModeOffset))
+	m.slotSize = slotSize
+	m.mask = slotCount - 1
+	m.size = slotCount
+	m.claimed = shmInt64(mem, shmClaimedOffset)
+	m.committed = shmInt64(mem, shmCommittedOffset)
+	m.consumed = shmInt64(mem, shmConsumedOffset)
+	return nil
+}
+
+// watch sets the heartbeat words of this handle and its peer and beats once.
+func (m *shmMapping) watch(beat int, peer int) {
+	m.beat = shmInt64(m.mem, beat)
+	m.peerBeat = shmInt64(m.mem, peer)
+	m.attached = time.Now().UnixNano()
+	m.Heartbeat()
+}
+
+// claim takes the exclusive role whose pid word is at offset for this process, if nobody holds it
+// or the process holding it has died. Otherwise the ring is unmapped and ErrShmAttached returned.
+func (m *shmMapping) claim(offset int) error {
+	word := shmInt32(m.mem, offset)
+	pid := int32(os.Getpid())
+	for {
+		current := atomic.LoadInt32(word)
+		if current != 0 && shmAlive(current) {
+			m.detach()
+			return ErrShmAttached
+		}
+		if atomic.CompareAndSwapInt32(word, current, pid) {
+			m.owner = word
+			return nil
+		}
+	}
+}
+
+// detach gives up the role held and unmaps the ring.
+func (m *shmMapping) detach() error {
+	if m.mem == nil {
+		return nil
+	}
+	if m.stop != nil {
+		close(m.stop)
+		<-m.stopped
+		m.stop = nil
+	}
+	if m.owner != nil {
+		atomic.CompareAndSwapInt32(m.owner, int32(os.Getpid()), 0)
+		m.owner = nil
+	}
+	err := syscall.Munmap(m.mem)
+	m.mem = nil
+	return err
+}
+
+// Heartbeat tells the peer this end is still alive. Call it regularly from the go routine using the
+// ring, or use StartHeartbeat.
+func (m *shmMapping) Heartbeat() {
+	atomic.StoreInt64(m.beat, time.Now().UnixNano())
+}
+
+// StartHeartbeat beats every interval from a go routine of its own until Close. A process that is
+// alive but whose ring go routine is stuck keeps beating, so calling Heartbeat from the ring go
+// routine catches more failures.
+func (m *shmMapping) StartHeartbeat(interval time.Duration) {
+	m.stop = make(chan bool)
+	m.stopped = make(chan bool)
+	go func(stop chan bool) {
+		defer close(m.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			m.Heartbeat()
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}(m.stop)
+}
+
+// SetPeerTimeout sets how long the peer may go without a heartbeat before it is reported dead.
+// Zero, the default, never reports it dead.
+func (m *shmMapping) SetPeerTimeout(d time.Duration) {
+	m.timeout = int64(d)
+}
+
+// PeerAlive reports whether the other end has beaten within the peer timeout. A peer that has never
+// beaten is given the timeout from when this end attached.
+func (m *shmMapping) PeerAlive() bool {
+	if m.timeout == 0 {
+		return true
+	}
+	last := atomic.LoadInt64(m.peerBeat)
+	if last < m.attached {
+		last = m.attached
+	}
+	return time.Now().UnixNano()-last <= m.timeout
+}
+
+// Mode returns how many producers may publish to the ring.
+func (m *shmMapping) Mode() ShmMode {
+	return m.mode
+}
+
+// Slot returns the bytes of the slot for index. The slice is only valid until Close.
+func (m *shmMapping) Slot(index int64) []byte {
+	offset := shmHeaderSize + (index&m.mask)*m.slotSize
+	return m.mem[offset : offset+m.slotSize : offset+m.slotSize]
+}
+
+// shmProducer publishes into a shared ring from one process.
+// In ShmSPSC mode only one process may be attached as producer and only one go routine may use it.
+// In ShmMPSC mode any number of processes may attach, and the producer may be shared by go routines.
+type shmProducer struct {
+	shmMapping
+}
+
+// AttachShmProducer is a factory function that attaches this process to the shared ring called name
+// as a producer. ErrShmAttached is returned if the ring is ShmSPSC and another live process is
+// already its producer.
+func AttachShmProducer(name string) (*shmProducer, error) {
+	p := &shmProducer{}
+	if err := p.attach(name); err != nil {
+		return nil, err
+	}
+	if p.mode == ShmSPSC {
+		if err := p.claim(shmProducerOffset); err != nil {
+			return nil, err
+		}
+	}
+	p.watch(shmProducerBeat, shmConsumerBeat)
+	return p, nil
+}
+
+// Reserve waits for a free slot and returns its index. Write the event into Slot(index) and then
+// call Commit.
+func (p *shmProducer) Reserve() int64 {
+	if p.mode == ShmSPSC {
+		index := atomic.LoadInt64(p.committed)
+		for index-atomic.LoadInt64(p.consumed) >= p.size {
+			runtime.Gosched()
+		}
+		return index
+	}
+	for {
+		previous := atomic.LoadInt64(p.claimed)
+		// Wait for room in the buffer if it is full.
+		for previous-atomic.LoadInt64(p.consumed) >= p.size {
+			runtime.Gosched()
+		}
+		// Try and store the new increment. If it was changed by another producer, loop and try again.
+		if atomic.CompareAndSwapInt64(p.claimed, previous, previous+1) {
+			return previous
+		}
+	}
+}
+
+// TryReserve is Reserve, except that while waiting for a free slot it returns ErrPeerDead if the
+// consumer stops beating for longer than the peer timeout.
+func (p *shmProducer) TryReserve() (int64, error) {
+	if p.mode == ShmSPSC {
+		index := atomic.LoadInt64(p.committed)
+		for index-atomic.LoadInt64(p.consumed) >= p.size {
+			if !p.PeerAlive() {
+				return 0, ErrPeerDead
+			}
+			runtime.Gosched()
+		}
+		return index, nil
+	}
+	for {
+		previous := atomic.LoadInt64(p.claimed)
+		// Wait for room in the buffer if it is full.
+		for previous-atomic.LoadInt64(p.consumed) >= p.size {
+			if !p.PeerAlive() {
+				return 0, ErrPeerDead
+			}
+			runtime.Gosched()
+		}
+		// Try and store the new increment. If it was changed by another producer, loop and try again.
+		if atomic.CompareAndSwapInt64(p.claimed, previous, previous+1) {
+			return previous, nil
+		}
+	}
+}
+
+// Reset recovers from a dead consumer. Every event it has not read is discarded and the consumer role
+// is freed, so a new consumer can attach even if the old process is hung rather than gone, and starts
+// with an empty ring. The caller must be sure the consumer is no longer using the ring, normally
+// because PeerAlive has reported it dead. A new consumer attaching without a Reset instead carries on
+// from the first unread event, if the old process has exited.
+func (p *shmProducer) Reset() {
+	atomic.StoreInt64(p.consumed, atomic.LoadInt64(p.committed))
+	atomic.StoreInt64(p.peerBeat, 0)
+	atomic.StoreInt32(shmInt32(p.mem, shmConsumerOffset), 0)
+}
+
+// Commit publishes the slot for index to the consumer. In ShmMPSC mode it waits for every earlier
+// slot to be published first, so the consumer never sees a gap.
+func (p *shmProducer) Commit(index int64) {
+	if p.mode == ShmMPSC {
+		for atomic.LoadInt64(p.committed) != index {
+			runtime.Gosched()
+		}
+	}
+	atomic.StoreInt64(p.committed, index+1)
+}
+
+// Close detaches the producer. The ring and anything published remain for the consumer.
+func (p *shmProducer) Close() error {
+	return p.detach()
+}
+
+// shmConsumer reads from a shared ring. Only one process may be attached as the consumer, and only
+// one go routine may use it.
+type shmConsumer struct {
+	shmMapping
+}
+
+// AttachShmConsumer is a factory function that attaches this process to the shared ring called name
+// as its consumer. ErrShmAttached is returned if another live process is already the consumer. A
+// consumer attaching after another has detached or died carries on from the first unread slot.
+func AttachShmConsumer(name string) (*shmConsumer, error) {
+	c := &shmConsumer{}
+	if err := c.attach(name); err != nil {
+		return nil, err
+	}
+	if err := c.claim(shmConsumerOffset); err != nil {
+		return nil, err
+	}
+	c.watch(shmConsumerBeat, shmProducerBeat)
+	return c, nil
+}
+
+// Reserve waits for a slot to be published and returns its index. Read the event from Slot(index)
+// and then call Commit.
+func (c *shmConsumer) Reserve() int64 {
+	index := atomic.LoadInt64(c.consumed)
+	for atomic.LoadInt64(c.committed) <= index {
+		runtime.Gosched()
+	}
+	return index
+}
+
+// TryReserve is Reserve, except that while waiting for a slot it returns ErrPeerDead if the producers
+// stop beating for longer than the peer timeout.
+func (c *shmConsumer) TryReserve() (int64, error) {
+	index := atomic.LoadInt64(c.consumed)
+	for atomic.LoadInt64(c.committed) <= index {
+		if !c.PeerAlive() {
+			return 0, ErrPeerDead
+		}
+		runtime.Gosched()
+	}
+	return index, nil
+}
+
+// Reset recovers from dead producers. Slots they claimed but never published are abandoned and the
+// producer role is freed, so a new producer can attach and carry on after the last event published.
+// The caller must be sure no producer is still using the ring, normally because PeerAlive has
+// reported them dead. In ShmMPSC mode the producers share a heartbeat, so this is only safe once all
+// of them are gone.
+func (c *shmConsumer) Reset() {
+	atomic.StoreInt64(c.claimed, atomic.LoadInt64(c.committed))
+	atomic.StoreInt64(c.peerBeat, 0)
+	atomic.StoreInt32(shmInt32(c.mem, shmProducerOffset), 0)
+}
+
+// Commit releases the slot for index back to the producers.
+func (c *shmConsumer) Commit(index int64) {
+	atomic.StoreInt64(c.consumed, index+1)
+}
+
+// Close detaches the consumer so another process may attach.
+func (c *shmConsumer) Close() error {
+	return c.detach()
+}
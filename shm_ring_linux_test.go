@@ -0,0 +1,345 @@
+//go:build linux
+// +build linux
+
+package ringo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A shared queue between go routines: Producer <==> Consumer through the mapped file.
+func TestShmRingSPSC(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	name := filepath.Join(t.TempDir(), "spsc")
+	if err := CreateShmRing(name, ShmSPSC, 8, 32); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	producer, err := AttachShmProducer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer producer.Close()
+	consumer, err := AttachShmConsumer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer consumer.Close()
+
+	done := make(chan bool)
+
+	go func() {
+		for i := int64(0); i < 1000; i++ {
+			ndx := consumer.Reserve()
+			if v := int64(binary.LittleEndian.Uint64(consumer.Slot(ndx))); v != i {
+				t.Errorf("Expected %d, got %d", i, v)
+			}
+			consumer.Commit(ndx)
+		}
+		close(done)
+	}()
+
+	for i := int64(0); i < 1000; i++ {
+		ndx := producer.Reserve()
+		binary.LittleEndian.PutUint64(producer.Slot(ndx), uint64(i))
+		producer.Commit(ndx)
+	}
+	<-done
+}
+
+// A Multi Producer shared queue: n-Producers <==> 1 Consumer
+func TestShmRingMPSC(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	name := filepath.Join(t.TempDir(), "mpsc")
+	if err := CreateShmRing(name, ShmMPSC, 16, 32); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	consumer, err := AttachShmConsumer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer consumer.Close()
+
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		producer, err := AttachShmProducer(name)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			defer producer.Close()
+			for i := 0; i < 250; i++ {
+				ndx := producer.Reserve()
+				slot := producer.Slot(ndx)
+				binary.LittleEndian.PutUint64(slot, uint64(p))
+				binary.LittleEndian.PutUint64(slot[8:], uint64(i))
+				producer.Commit(ndx)
+			}
+		}(p)
+	}
+
+	// Each producer's events arrive in the order it published them.
+	var next [4]uint64
+	for i := 0; i < 1000; i++ {
+		ndx := consumer.Reserve()
+		slot := consumer.Slot(ndx)
+		p, v := binary.LittleEndian.Uint64(slot), binary.LittleEndian.Uint64(slot[8:])
+		if v != next[p] {
+			t.Fatalf("Expected %d from producer %d, got %d", next[p], p, v)
+		}
+		next[p]++
+		consumer.Commit(ndx)
+	}
+	wg.Wait()
+}
+
+// Roles are exclusive while held and free again after Close, and headers are validated.
+func TestShmRingAttach(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "attach")
+	if err := CreateShmRing(name, ShmSPSC, 8, 16); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := CreateShmRing(name, ShmSPSC, 8, 16); !os.IsExist(err) {
+		t.Errorf("Expected an exists error, got %v", err)
+	}
+	if err := CreateShmRing(filepath.Join(dir, "bad"), ShmSPSC, 8, 10); err == nil {
+		t.Error("Expected an error for a slot count that is not a power of two")
+	}
+
+	consumer, err := AttachShmConsumer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, err := AttachShmConsumer(name); err != ErrShmAttached {
+		t.Errorf("Expected ErrShmAttached, got %v", err)
+	}
+	producer, err := AttachShmProducer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, err := AttachShmProducer(name); err != ErrShmAttached {
+		t.Errorf("Expected ErrShmAttached, got %v", err)
+	}
+
+	// Publish one event and hand it to a fresh consumer.
+	ndx := producer.Reserve()
+	producer.Slot(ndx)[0] = 42
+	producer.Commit(ndx)
+	consumer.Close()
+	consumer, err = AttachShmConsumer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if ndx := consumer.Reserve(); ndx != 0 || consumer.Slot(ndx)[0] != 42 {
+		t.Errorf("Expected event 42 at 0, got %d at %d", consumer.Slot(ndx)[0], ndx)
+	}
+	consumer.Close()
+	producer.Close()
+
+	// A file that is not a ring.
+	junk := filepath.Join(dir, "junk")
+	if err := os.WriteFile(junk, make([]byte, 4096), 0600); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if _, err := AttachShmConsumer(junk); err != ErrShmIncompatible {
+		t.Errorf("Expected ErrShmIncompatible, got %v", err)
+	}
+}
+
+// A producer in another process publishing to a consumer in this one. The test binary runs itself
+// as the producer.
+func TestShmRingProcess(t *testing.T) {
+	if name := os.Getenv("RINGO_SHM_PRODUCER"); name != "" {
+		producer, err := AttachShmProducer(name)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		for i := int64(0); i < 1000; i++ {
+			ndx := producer.Reserve()
+			binary.LittleEndian.PutUint64(producer.Slot(ndx), uint64(i*i))
+			producer.Commit(ndx)
+		}
+		producer.Close()
+		return
+	}
+
+	name := filepath.Join(t.TempDir(), "process")
+	if err := CreateShmRing(name, ShmSPSC, 8, 64); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	consumer, err := AttachShmConsumer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestShmRingProcess$")
+	cmd.Env = append(os.Environ(), "RINGO_SHM_PRODUCER="+name)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	waited := make(chan error, 1)
+	go func() {
+		waited <- cmd.Wait()
+	}()
+
+	done := make(chan bool)
+
+	go func() {
+		for i := int64(0); i < 1000; i++ {
+			ndx := consumer.Reserve()
+			if v := int64(binary.LittleEndian.Uint64(consumer.Slot(ndx))); v != i*i {
+				t.Errorf("Expected %d, got %d", i*i, v)
+			}
+			consumer.Commit(ndx)
+		}
+		close(done)
+	}()
+
+	// The producer exiting early would leave the consumer waiting forever.
+	if err := <-waited; err != nil {
+		t.Fatalf("Producer failed: %s: %s", err, out.String())
+	}
+	<-done
+	consumer.Close()
+}
+
+// A producer finds its consumer dead, resets the ring and carries on with a new consumer.
+func TestShmRingConsumerDead(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dead")
+	if err := CreateShmRing(name, ShmSPSC, 8, 4); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	producer, err := AttachShmProducer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer producer.Close()
+	producer.SetPeerTimeout(20 * time.Millisecond)
+
+	// The consumer beats while it reads, then hangs.
+	hung, err := AttachShmConsumer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for i := 0; i < 6; i++ {
+		ndx, err := producer.TryReserve()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		producer.Commit(ndx)
+		if i == 3 {
+			hung.Heartbeat()
+			hung.Commit(hung.Reserve())
+			hung.Commit(hung.Reserve())
+		}
+	}
+	if !producer.PeerAlive() {
+		t.Error("Expected the consumer to be alive")
+	}
+	start := time.Now()
+	if _, err := producer.TryReserve(); err != ErrPeerDead {
+		t.Fatalf("Expected ErrPeerDead, got %v", err)
+	}
+	if time.Since(start) < 10*time.Millisecond {
+		t.Errorf("Consumer reported dead too soon")
+	}
+
+	// Without a reset the role is still held.
+	if _, err := AttachShmConsumer(name); err != ErrShmAttached {
+		t.Errorf("Expected ErrShmAttached, got %v", err)
+	}
+	producer.Reset()
+	consumer, err := AttachShmConsumer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	consumer.StartHeartbeat(time.Millisecond)
+	if !producer.PeerAlive() {
+		t.Error("Expected the new consumer to be alive")
+	}
+
+	done := make(chan bool)
+
+	go func() {
+		for i := int64(0); i < 100; i++ {
+			ndx := consumer.Reserve()
+			if v := int64(binary.LittleEndian.Uint64(consumer.Slot(ndx))); v != i {
+				t.Errorf("Expected %d, got %d", i, v)
+			}
+			consumer.Commit(ndx)
+		}
+		close(done)
+	}()
+
+	for i := int64(0); i < 100; i++ {
+		ndx, err := producer.TryReserve()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		binary.LittleEndian.PutUint64(producer.Slot(ndx), uint64(i))
+		producer.Commit(ndx)
+	}
+	<-done
+	consumer.Close()
+	hung.Close()
+}
+
+// A consumer finds its producer dead and a new producer takes over after a reset.
+func TestShmRingProducerDead(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dead")
+	if err := CreateShmRing(name, ShmSPSC, 8, 4); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	consumer, err := AttachShmConsumer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer consumer.Close()
+	consumer.SetPeerTimeout(20 * time.Millisecond)
+
+	hung, err := AttachShmProducer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	hung.Commit(hung.Reserve())
+	if ndx, err := consumer.TryReserve(); err != nil || ndx != 0 {
+		t.Fatalf("Expected 0 and no error, got %d and %v", ndx, err)
+	}
+	consumer.Commit(0)
+	if _, err := consumer.TryReserve(); err != ErrPeerDead {
+		t.Fatalf("Expected ErrPeerDead, got %v", err)
+	}
+
+	consumer.Reset()
+	producer, err := AttachShmProducer(name)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer producer.Close()
+	ndx := producer.Reserve()
+	producer.Slot(ndx)[0] = 7
+	producer.Commit(ndx)
+	if ndx, err := consumer.TryReserve(); err != nil || ndx != 1 || consumer.Slot(ndx)[0] != 7 {
+		t.Errorf("Expected event 7 at 1, got %d and %v", ndx, err)
+	}
+	hung.Close()
+}
@@ -1,6 +1,9 @@
 package ringo
 
-import "runtime"
+import (
+	"runtime"
+	"sync/atomic"
+)
 
 // simpleConsumeNode represents a reader, a consumer who processes entries from the ring buffer.
 // Each go routine that acts as a consumer should have an instantiated object for tracking it's results.
@@ -9,6 +12,8 @@ type simpleConsumeNode struct {
 	committed  int64 // Read counter and index to the next ring buffer entry.
 	cachepad2  [7]int64
 	dependency *int64 // The committed register that this object is dependent on to finish.
+	evictable
+	nodeDebug
 }
 
 // NewSimpleConsumeNode is a factory function for returning a new instance of a simpleConsumeNode.
@@ -19,17 +24,82 @@ func NewSimpleConsumeNode() *simpleConsumeNode {
 // Reserve is used by the consumer to validate it should read a new item from the buffer.
 // It returns the next index as a pointer.
 func (s *simpleConsumeNode) Reserve() *int64 {
-	for *s.dependency-s.committed == 0 {
+	for s.waiting() {
 		runtime.Gosched()
 	}
+	if debugging {
+		s.reserved(s.committed)
+	}
 	return &s.committed
 }
 
 // Commit increments the counter to indicate an entry has been read.
 func (s *simpleConsumeNode) Commit() {
+	if debugging {
+		s.committing(s.committed)
+		s.passing(s.committed + 1)
+	}
 	s.committed++
 }
 
+// ReserveBatch waits for work and returns every index that is available for reading,
+// from up to but not including to. Use Segments to find where these lie in the ring.
+func (s *simpleConsumeNode) ReserveBatch() (int64, int64) {
+	for s.waiting() {
+		runtime.Gosched()
+	}
+	return s.committed, *s.dependency
+}
+
+// pollBatch returns every index that is available for reading without waiting, from up to but not
+// including to. They are equal if there are none.
+func (s *simpleConsumeNode) pollBatch() (int64, int64) {
+	if s.evictor != nil {
+		s.skip()
+	}
+	return s.committed, atomic.LoadInt64(s.dependency)
+}
+
+// waiting reports whether there is nothing to read, once any events lost to an eviction are skipped.
+func (s *simpleConsumeNode) waiting() bool {
+	if s.evictor != nil {
+		s.skip()
+	}
+	return *s.dependency-s.committed == 0
+}
+
+// skip moves the counter past the events lost to an eviction, but never past the dependency. Nodes
+// that depend on this one see the counter jump and skip the same events themselves.
+func (s *simpleConsumeNode) skip() {
+	oldest := s.evictor.Oldest()
+	if s.committed >= oldest {
+		return
+	}
+	if dep := atomic.LoadInt64(s.dependency); oldest > dep {
+		oldest = dep
+	}
+	atomic.AddInt64(&s.missed, oldest-s.committed)
+	atomic.StoreInt64(&s.committed, oldest)
+}
+
+// CommitBatch moves the counter to indicate all entries up to but not including to have been read.
+func (s *simpleConsumeNode) CommitBatch(to int64) {
+	if debugging {
+		if to < s.committed {
+			s.violated("CommitBatch to %d would move back from %d", to, s.committed)
+		}
+		s.passing(to)
+	}
+	s.committed = to
+}
+
+// passing checks that committing up to but not including to does not pass the dependency.
+func (s *simpleConsumeNode) passing(to int64) {
+	if dep := atomic.LoadInt64(s.dependency); to > dep {
+		s.violated("Commit to %d passes its dependency at %d", to, dep)
+	}
+}
+
 // Committed returns a pointer to the committed counter.
 func (s *simpleConsumeNode) Committed() *int64 {
 	return &s.committed
@@ -39,3 +109,14 @@ func (s *simpleConsumeNode) Committed() *int64 {
 func (s *simpleConsumeNode) SetDependency(d *int64) {
 	s.dependency = d
 }
+
+// Sequence returns the index of the next entry to be read.
+func (s *simpleConsumeNode) Sequence() int64 {
+	return atomic.LoadInt64(&s.committed)
+}
+
+// SetSequence positions the node so the next entry read is at seq.
+// It must be called before the node is in use.
+func (s *simpleConsumeNode) SetSequence(seq int64) {
+	s.committed = seq
+}
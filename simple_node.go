@@ -2,6 +2,7 @@ package ringo
 
 import (
 	"math"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,12 +12,16 @@ import (
 type simpleNode struct {
 	cachepad1  [8]int64 // Cacheline padding.
 	cursor     int64    // Tracks the cell id being processed in the ring.
-	cachepad2  [7]int64 // Cacheline padding.
+	done       int64    // The next cell to be committed. Cells reserved in a batch may be ahead of it.
+	cachepad2  [6]int64 // Cacheline padding.
 	committed  []int32  // Tracks this nodes progress.
 	dependency []int32  // Measures a dependent nodes progress.
 	barrier    int64    // Used to find the next dependent cell to check.
 	mask       int64    // Used in place of modulo for index calculations.
 	shift      uint8    // Used to mark a cell with which rotation processed.
+	publishPolicy
+	evictable
+	nodeDebug
 }
 
 // NewSimpleNode is a factory function that returns a single simpleNode instance.
@@ -42,21 +47,131 @@ func NewSimpleNode(leader bool, size int64) *simpleNode {
 // It validates that the cell has been processed by a dependency node and if free returns that index
 // for use.
 func (s *simpleNode) Reserve() int64 {
-	s.cursor++                   // Increment the pointer to the next cell.
+	s.cursor++ // Increment the pointer to the next cell.
+	if s.evictor != nil {
+		s.cursor = s.skip(s.cursor)
+	}
 	gate := s.cursor - s.barrier // Calculate the dependency marker.
 
 	// Validate that the dependency has completed processing on this cell and it's free for use.
-	// If not, wait until it is.
+	// If not, wait until it is. A node following an evicting publisher skips the cells it loses
+	// while it waits, as the dependency will never stamp them with the rotation it expects.
 	for s.dependency[s.cursor&s.mask] != int32(gate>>s.shift) {
+		if s.evictor != nil {
+			if next := s.skip(s.cursor); next != s.cursor {
+				s.cursor = next
+				gate = s.cursor - s.barrier
+				continue
+			}
+		}
 		time.Sleep(time.Microsecond)
 	}
 	return s.cursor
 }
 
+// TryReserve is used by a leader to allocate a cell in the ring buffer, applying its policy if the
+// buffer is full. ErrFull or ErrDropped is returned if the policy refuses the item. If the policy
+// evicts, the oldest unconsumed event is given up.
+func (s *simpleNode) TryReserve() (int64, error) {
+	next := s.cursor + 1
+	if s.dependency[next&s.mask] != int32((next-s.barrier)>>s.shift) {
+		wait, err := s.full()
+		if err != nil {
+			return 0, err
+		}
+		if wait {
+			return s.Reserve(), nil
+		}
+		s.evict(next, s.barrier)
+	}
+	s.cursor = next
+	return next, nil
+}
+
 // Commit marks a cell in the ring status as completed. Any other node that is relying on this
 // node to complete it's work can now know it may proceed to use it's corresponding cell.
 func (s *simpleNode) Commit(index int64) {
+	if debugging {
+		s.committingAt(index)
+	}
 	s.committed[index&s.mask] = int32(index >> s.shift)
+	s.done = index + 1
+}
+
+// ReserveBatch waits for work and returns every index that is available for processing,
+// from up to but not including to. Use Segments to find where these lie in the ring.
+func (s *simpleNode) ReserveBatch() (int64, int64) {
+	from := s.Reserve()
+	to := from + 1
+	for to-from < s.mask+1 && s.dependency[to&s.mask] == int32((to-s.barrier)>>s.shift) {
+		to++
+	}
+	s.cursor = to - 1
+	return from, to
+}
+
+// pollBatch reserves every index that is available for processing without waiting, from up to but
+// not including to. They are equal if there are none.
+func (s *simpleNode) pollBatch() (int64, int64) {
+	from := s.cursor + 1
+	if s.evictor != nil {
+		from = s.skip(from)
+	}
+	to := from
+	for to-from < s.mask+1 && s.dependency[to&s.mask] == int32((to-s.barrier)>>s.shift) {
+		to++
+	}
+	s.cursor = to - 1
+	return from, to
+}
+
+// skip returns where a node following an evicting publisher should carry on from, if next and the
+// cells after it have been lost to an eviction. The cells skipped are stamped as completed so the
+// nodes that depend on this one are not held up; as they follow the evictor too, they skip them.
+func (s *simpleNode) skip(next int64) int64 {
+	oldest := s.evictor.Oldest()
+	if next >= oldest {
+		return next
+	}
+	atomic.AddInt64(&s.missed, oldest-next)
+	from := next
+	if oldest-from > s.mask+1 {
+		from = oldest - (s.mask + 1) // Only the last rotation of each cell needs stamping.
+	}
+	for index := from; index < oldest; index++ {
+		s.committed[index&s.mask] = int32(index >> s.shift)
+	}
+	if debugging {
+		s.next = oldest
+	}
+	s.done = oldest
+	return oldest
+}
+
+// CommitBatch marks every cell from up to but not including to as completed.
+func (s *simpleNode) CommitBatch(from int64, to int64) {
+	for index := from; index < to; index++ {
+		if debugging {
+			s.committingAt(index)
+		}
+		s.committed[index&s.mask] = int32(index >> s.shift)
+	}
+	if to > from {
+		s.done = to
+	}
+}
+
+// committingAt checks that index is the next reserved cell, that its dependency has finished with
+// it and that its stamp moves forward.
+func (s *simpleNode) committingAt(index int64) {
+	if index != s.next || index > s.cursor {
+		s.violated("Commit of %d out of order, expected %d with %d reserved", index, s.next, s.cursor)
+	}
+	s.next++
+	if s.barrier == 0 || index >= s.Oldest()+s.barrier {
+		s.gated(s.dependency, index, s.barrier, s.mask, s.shift)
+	}
+	s.stamping(s.committed, index, s.mask, s.shift)
 }
 
 // Committed is a getter for the commit ring of this node.
@@ -68,3 +183,25 @@ func (s *simpleNode) Committed() []int32 {
 func (s *simpleNode) SetDependency(dep []int32) {
 	s.dependency = dep
 }
+
+// Sequence returns the index of the next cell to be committed. Cells reserved by a batch that is
+// still being processed are not counted until they are committed.
+func (s *simpleNode) Sequence() int64 {
+	return atomic.LoadInt64(&s.done)
+}
+
+// Occupancy returns how many cells a leader has published that its dependency has not finished.
+func (s *simpleNode) Occupancy() int64 {
+	next := s.Sequence()
+	return next - ringProgress(s.dependency, next-s.barrier, next, s.shift)
+}
+
+// SetSequence positions the node so the next cell reserved is at seq, and stamps its commit ring as
+// if every cell below seq had been committed. Nodes that depend on each other must be positioned at
+// the same sequence. It must be called before the node is in use.
+func (s *simpleNode) SetSequence(seq int64) {
+	s.cursor = seq - 1
+	s.done = seq
+	s.next = seq
+	stampRing(s.committed, seq, s.shift)
+}
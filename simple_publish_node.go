@@ -1,15 +1,21 @@
 package ringo
 
-import "runtime"
+import (
+	"runtime"
+	"sync/atomic"
+)
 
 // simplePublishNode represents a publisher, a job source who submits entries into the ring buffer.
 // There is no locking with this implementation. Only one go routine that acts as a publisher should
 // have an instantiate object for publishing events.
 type simplePublishNode struct {
-	committed  int64 // Write counter and index to the next ring buffer entry.
-	cachepad1  [7]int64
-	dependency *int64 // The committed register that this object is dependent on to finish.
-	buffSize   int64  // Size of the ring buffer.
+	committed int64 // Write counter and index to the next ring buffer entry.
+	cachepad1 [7]int64
+	gate      int64     // Lowest dependency when last read, cached to save reading them all.
+	gating    gatingSet // The committed registers that this object is dependent on to finish.
+	buffSize  int64     // Size of the ring buffer.
+	publishPolicy
+	nodeDebug
 }
 
 // NewSimplePublishNode is a factory function for returning a new instance of a simplePublishNode.
@@ -22,23 +28,104 @@ func NewSimplePublishNode(size int64) *simplePublishNode {
 // Reserve is used by the publisher to validate it can store a new item on the buffer.
 // It returns the next index as a pointer.
 func (s *simplePublishNode) Reserve() *int64 {
-	for s.committed-*s.dependency == s.buffSize {
+	for s.wrapped() {
 		runtime.Gosched()
 	}
+	if debugging {
+		s.reserved(s.committed)
+	}
 	return &s.committed
 }
 
+// TryReserve is used by the publisher to store a new item on the buffer, applying its policy if the
+// buffer is full. It returns the next index as a pointer, or ErrFull or ErrDropped if the policy
+// refuses the item. If the policy evicts, the oldest unconsumed event is given up.
+func (s *simplePublishNode) TryReserve() (*int64, error) {
+	if s.wrapped() {
+		wait, err := s.full()
+		if err != nil {
+			return nil, err
+		}
+		if wait {
+			return s.Reserve(), nil
+		}
+		s.evict(s.committed, s.buffSize)
+	}
+	if debugging {
+		s.reserved(s.committed)
+	}
+	return &s.committed, nil
+}
+
 // Commit increments the counter to indicate an entry has been stored or read.
 func (s *simplePublishNode) Commit() {
+	if debugging {
+		s.committing(s.committed)
+		if gate := s.gating.lowest(s.committed); s.committed-gate >= s.buffSize &&
+			s.committed >= s.Oldest()+s.buffSize {
+			s.violated("Commit of %d overwrites %d before its slowest dependency at %d read it",
+				s.committed, s.committed-s.buffSize, gate)
+		}
+	}
 	s.committed++
 }
 
+// Occupancy returns how many events have been published that the slowest dependency has not finished.
+func (s *simplePublishNode) Occupancy() int64 {
+	committed := atomic.LoadInt64(&s.committed)
+	return committed - s.gating.lowest(committed)
+}
+
 // Committed returns a pointer to the committed counter.
 func (s *simplePublishNode) Committed() *int64 {
 	return &s.committed
 }
 
-// SetDependency is a setter for the dependency of this node.
+// wrapped reports whether the next entry would overwrite one a dependency has not finished with.
+// The dependencies are only read again when the cached gate says the buffer is full.
+func (s *simplePublishNode) wrapped() bool {
+	if s.committed-s.gate < s.buffSize {
+		return false
+	}
+	s.gate = s.gating.lowest(s.committed)
+	return s.committed-s.gate >= s.buffSize
+}
+
+// SetDependency is a setter for the dependency of this node. It replaces any dependencies added.
 func (s *simplePublishNode) SetDependency(d *int64) {
-	s.dependency = d
+	s.gating.set(d)
+}
+
+// AddDependency adds a committed register this node must not overtake. It may be called while the
+// node is publishing. Use Attach to add a new consumer at the current position.
+func (s *simplePublishNode) AddDependency(d *int64) {
+	s.gating.add(d)
+}
+
+// RemoveDependency removes a committed register added with SetDependency or AddDependency, so a
+// consumer can be detached while the node is publishing. It returns false if d was not found.
+func (s *simplePublishNode) RemoveDependency(d *int64) bool {
+	return s.gating.remove(d)
+}
+
+// Attach wires up a new consumer, such as an audit tap, to read from the next entry to be published
+// and adds it as a dependency. It may be called while the node is publishing, from any go routine,
+// as long as the consumer is not yet in use.
+func (s *simplePublishNode) Attach(c *simpleConsumeNode) {
+	c.SetDependency(&s.committed)
+	atomic.StoreInt64(&c.committed, atomic.LoadInt64(&s.committed))
+	s.AddDependency(&c.committed)
+	// The publisher may have moved on before it saw the new dependency, but can no longer pass it.
+	atomic.StoreInt64(&c.committed, atomic.LoadInt64(&s.committed))
+}
+
+// Sequence returns the index of the next entry to be published.
+func (s *simplePublishNode) Sequence() int64 {
+	return atomic.LoadInt64(&s.committed)
+}
+
+// SetSequence positions the node so the next entry published is at seq.
+// It must be called before the node is in use.
+func (s *simplePublishNode) SetSequence(seq int64) {
+	s.committed = seq
 }
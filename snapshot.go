@@ -0,0 +1,196 @@
+package ringo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Snapshots are written one per file, named after the sequence they reflect, so they sort in order.
+const snapshotExt = ".snapshot"
+
+// Snapshotter writes the application state built up by a consumer.
+type Snapshotter interface {
+	// Snapshot writes the state reflecting every event below seq, and nothing from seq on, to w.
+	Snapshot(w io.Writer, seq int64) error
+}
+
+// snapshotCoordinator is a gate placed in front of the consumer that owns the application state.
+// In its Run loop it passes the committed counter of its dependency on to the consumer unchanged.
+// When a snapshot is asked for, the gate is held, the consumer is left to drain everything up to it
+// and the snapshot is written while the consumer is idle at that sequence boundary. Restoring the
+// snapshot and replaying the journal from its sequence rebuilds the same state.
+type snapshotCoordinator struct {
+	cachepad1   [8]int64
+	committed   int64 // Count of events passed on to the consumer.
+	cachepad2   [7]int64
+	dependency  *int64      // The committed register that this object is dependent on to finish.
+	consumer    *int64      // The committed register of the consumer being snapshotted.
+	dir         string      // Directory the snapshots are written to.
+	snapshotter Snapshotter // Writes the consumer's state.
+	mu          sync.Mutex  // Held to keep the gate closed while a snapshot is taken.
+	running     bool        // Is this coordinator chasing the dependency in a Run() loop?
+}
+
+// NewSnapshotCoordinator is a factory function for returning a new instance of a snapshotCoordinator.
+// Snapshots are written to dir, which is created if needed.
+func NewSnapshotCoordinator(dir string, s Snapshotter) (*snapshotCoordinator, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &snapshotCoordinator{
+		dir:         dir,
+		snapshotter: s,
+	}, nil
+}
+
+// Run continually passes on the committed counter of the dependency until Stop is called.
+func (s *snapshotCoordinator) Run() {
+	s.running = true
+	for s.running {
+		s.mu.Lock()
+		atomic.StoreInt64(&s.committed, atomic.LoadInt64(s.dependency))
+		s.mu.Unlock()
+		runtime.Gosched()
+	}
+}
+
+// Stop breaks the loop cycle of the run.
+func (s *snapshotCoordinator) Stop() {
+	s.running = false
+}
+
+// Running returns the state of the running flag.
+func (s *snapshotCoordinator) Running() bool {
+	return s.running
+}
+
+// Committed returns a pointer to the committed counter.
+func (s *snapshotCoordinator) Committed() *int64 {
+	return &s.committed
+}
+
+// SetDependency sets the dependent commit counter of this node.
+func (s *snapshotCoordinator) SetDependency(d *int64) {
+	s.dependency = d
+}
+
+// SetConsumer sets the committed counter of the consumer whose state is snapshotted. The consumer
+// must depend on this coordinator.
+func (s *snapshotCoordinator) SetConsumer(c *int64) {
+	s.consumer = c
+}
+
+// Sequence returns the count of events passed on to the consumer.
+func (s *snapshotCoordinator) Sequence() int64 {
+	return atomic.LoadInt64(&s.committed)
+}
+
+// SetSequence positions the coordinator at seq, which should match its consumer.
+// It must be called before the coordinator is in use.
+func (s *snapshotCoordinator) SetSequence(seq int64) {
+	s.committed = seq
+}
+
+// Snapshot holds the gate, waits for the consumer to process every event passed through it and then
+// has the Snapshotter write the consumer's state. It may be called from any go routine while Run is
+// looping. The file is replaced atomically, so a crash while writing leaves the earlier snapshots.
+// It returns the sequence the snapshot reflects, which is where replay should start from.
+func (s *snapshotCoordinator) Snapshot() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := atomic.LoadInt64(&s.committed)
+	for atomic.LoadInt64(s.consumer) < seq {
+		runtime.Gosched()
+	}
+
+	path := snapshotPath(s.dir, seq)
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return seq, err
+	}
+	w := bufio.NewWriter(file)
+	if err = s.snapshotter.Snapshot(w, seq); err == nil {
+		if err = w.Flush(); err == nil {
+			err = file.Sync()
+		}
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return seq, err
+	}
+	return seq, syncDir(s.dir)
+}
+
+// snapshotPath returns the path of the snapshot for seq.
+func snapshotPath(dir string, seq int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", seq, snapshotExt))
+}
+
+// Snapshots returns the sequences of the snapshots in dir, oldest first.
+func Snapshots(dir string) ([]int64, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*"+snapshotExt))
+	if err != nil {
+		return nil, err
+	}
+	seqs := make([]int64, 0, len(names))
+	for _, name := range names {
+		seq, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(name), snapshotExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	// The names are zero padded, so Glob has already sorted them.
+	return seqs, nil
+}
+
+// LoadSnapshot hands the latest snapshot in dir to fn and returns the sequence it reflects. Replay
+// the journal from that sequence to bring the state up to date. If there are no snapshots, fn is not
+// called and zero is returned, so the whole journal is replayed.
+func LoadSnapshot(dir string, fn func(r io.Reader, seq int64) error) (int64, error) {
+	seqs, err := Snapshots(dir)
+	if err != nil || len(seqs) == 0 {
+		return 0, err
+	}
+	seq := seqs[len(seqs)-1]
+	file, err := os.Open(snapshotPath(dir, seq))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if err := fn(bufio.NewReader(file), seq); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// PruneJournal deletes the segments of the journal in dir that only hold events below seq, normally
+// the sequence of the latest snapshot. The segment holding seq, and the last segment, are kept.
+func PruneJournal(dir string, seq int64) error {
+	segments, err := JournalSegments(dir)
+	if err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(segments) && segments[i+1].First <= seq; i++ {
+		if err := os.Remove(segments[i].Path); err != nil {
+			return err
+		}
+	}
+	return syncDir(dir)
+}
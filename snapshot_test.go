@@ -0,0 +1,150 @@
+package ringo
+
+import (
+	"encoding/binary"
+	"io"
+	"runtime"
+	"testing"
+)
+
+// sumState is application state built by adding up the events in a ring.
+type sumState struct {
+	ring []int64
+	sum  int64
+}
+
+func (s *sumState) Snapshot(w io.Writer, seq int64) error {
+	return binary.Write(w, binary.LittleEndian, s.sum)
+}
+
+// A journaled topology snapshotted part way through, then rebuilt from the snapshot:
+// 1 SimplePublishNode => Journaler => SnapshotCoordinator => 1 SimpleConsumeNode
+func TestSnapshotCoordinator(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	dir := t.TempDir()
+	state := &sumState{ring: make([]int64, 32)}
+	j, err := OpenJournal(dir, 256)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Build the components
+	publisher := NewSimplePublishNode(32)
+	journaler := NewJournaler(j, &int64Codec{ring: state.ring})
+	coordinator, err := NewSnapshotCoordinator(dir, state)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	consumer := NewSimpleConsumeNode()
+
+	// Link the committed counter dependencies together.
+	journaler.SetDependency(publisher.Committed())
+	coordinator.SetDependency(journaler.Committed())
+	coordinator.SetConsumer(consumer.Committed())
+	consumer.SetDependency(coordinator.Committed())
+	publisher.SetDependency(consumer.Committed())
+
+	done := make(chan bool)
+	journaled := make(chan error)
+
+	go func() {
+		journaled <- journaler.Run()
+	}()
+
+	go func() {
+		coordinator.Run()
+	}()
+
+	go func() {
+		for i := int64(0); i < 256; i++ {
+			ndx := *consumer.Reserve()
+			state.sum += state.ring[ndx&31]
+			consumer.Commit()
+		}
+		done <- true
+	}()
+
+	var snapshot int64
+	for i := int64(0); i < 256; i++ {
+		ndx := *publisher.Reserve()
+		state.ring[ndx&31] = ndx
+		publisher.Commit()
+		if i == 150 {
+			for coordinator.Sequence() < 100 {
+				runtime.Gosched()
+			}
+			if snapshot, err = coordinator.Snapshot(); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+		}
+	}
+
+	<-done
+	coordinator.Stop()
+	journaler.Stop()
+	if err := <-journaled; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	j.Close()
+	if snapshot < 100 || snapshot > 151 {
+		t.Fatalf("Expected a snapshot between 100 and 151, got %d", snapshot)
+	}
+
+	// Drop the journal the snapshot covers.
+	if err := PruneJournal(dir, snapshot); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	segments, err := JournalSegments(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(segments) < 2 || segments[0].First > snapshot || segments[1].First <= snapshot {
+		t.Fatalf("Unexpected segments after prune at %d: %v", snapshot, segments)
+	}
+
+	// Rebuild the state from the snapshot and the rest of the journal.
+	restored := &sumState{ring: make([]int64, 256)}
+	seq, err := LoadSnapshot(dir, func(r io.Reader, seq int64) error {
+		return binary.Read(r, binary.LittleEndian, &restored.sum)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if seq != snapshot {
+		t.Fatalf("Expected snapshot %d, got %d", snapshot, seq)
+	}
+	if restored.sum != seq*(seq-1)/2 {
+		t.Errorf("Expected snapshot sum %d, got %d", seq*(seq-1)/2, restored.sum)
+	}
+
+	replayer := NewSimplePublishNode(256)
+	replayer.SetSequence(seq)
+	replayer.SetDependency(&seq)
+	next, err := Replay(dir, seq, &int64Codec{ring: restored.ring}, replayer)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if next != 256 {
+		t.Fatalf("Expected replay to end at 256, got %d", next)
+	}
+	for i := seq; i < next; i++ {
+		restored.sum += restored.ring[i&255]
+	}
+	if restored.sum != 256*255/2 {
+		t.Errorf("Expected restored sum %d, got %d", 256*255/2, restored.sum)
+	}
+}
+
+// Without a snapshot, replay starts from the beginning.
+func TestLoadSnapshotNone(t *testing.T) {
+	seq, err := LoadSnapshot(t.TempDir(), func(io.Reader, int64) error {
+		t.Error("Unexpected call with no snapshot")
+		return nil
+	})
+	if err != nil || seq != 0 {
+		t.Errorf("Expected 0 and no error, got %d and %v", seq, err)
+	}
+}
@@ -0,0 +1,85 @@
+package ringo
+
+import (
+	"math"
+	"runtime"
+	"sync/atomic"
+)
+
+// statusBridge presents the progress of a Type 1 committed counter as a Type 2 status ring. Each time
+// the counter moves on, the cells it has passed are marked with their rotation, so Type 2 nodes can
+// depend on a Type 1 node through it.
+type statusBridge struct {
+	cachepad1  [8]int64 // Cacheline padding.
+	cursor     int64    // The last cell marked.
+	cachepad2  [7]int64 // Cacheline padding.
+	committed  []int32  // Tracks the progress of the dependency.
+	dependency *int64   // The committed counter being followed.
+	mask       int64    // Used in place of modulo for index calculations.
+	shift      uint8    // Used to mark a cell with which rotation processed.
+	running    bool     // Is this bridge chasing the dependency in a Run() loop?
+}
+
+// NewStatusBridge is a factory function for returning a new instance of a statusBridge for a ring
+// of size.
+func NewStatusBridge(size int64) *statusBridge {
+	b := &statusBridge{
+		cursor:    int64(initSeqValue),
+		committed: make([]int32, size),
+		mask:      size - 1,
+		shift:     uint8(math.Log2(float64(size))),
+	}
+
+	for i := int64(0); i < size; i++ {
+		b.committed[i] = int32(initSeqValue)
+	}
+	return b
+}
+
+// Run continually marks the cells passed by the dependency until Stop is called.
+func (b *statusBridge) Run() {
+	b.running = true
+	for b.running {
+		available := atomic.LoadInt64(b.dependency)
+		if available-1 == b.cursor {
+			runtime.Gosched()
+			continue
+		}
+		for index := b.cursor + 1; index < available; index++ {
+			atomic.StoreInt32(&b.committed[index&b.mask], int32(index>>b.shift))
+		}
+		atomic.StoreInt64(&b.cursor, available-1)
+	}
+}
+
+// Stop breaks the loop cycle of the run.
+func (b *statusBridge) Stop() {
+	b.running = false
+}
+
+// Running returns the state of the running flag.
+func (b *statusBridge) Running() bool {
+	return b.running
+}
+
+// Committed is a getter for the commit ring of this bridge.
+func (b *statusBridge) Committed() []int32 {
+	return b.committed
+}
+
+// SetDependency sets the committed counter this bridge follows.
+func (b *statusBridge) SetDependency(d *int64) {
+	b.dependency = d
+}
+
+// Sequence returns the index of the next cell to be marked.
+func (b *statusBridge) Sequence() int64 {
+	return atomic.LoadInt64(&b.cursor) + 1
+}
+
+// SetSequence positions the bridge so the next cell marked is at seq, and stamps its commit ring as
+// if every cell below seq had been marked. It must be called before the bridge is in use.
+func (b *statusBridge) SetSequence(seq int64) {
+	b.cursor = seq - 1
+	stampRing(b.committed, seq, b.shift)
+}
@@ -0,0 +1,267 @@
+package ringo
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ErrPanic is matched by every PanicError, for use with errors.Is.
+var ErrPanic = errors.New("ringo: run loop panicked")
+
+// PanicError is returned for a supervised run loop that panicked.
+type PanicError struct {
+	Value interface{} // The value passed to panic.
+	Stack []byte      // The stack of the go routine that panicked.
+}
+
+// Error returns a description of the panic.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrPanic, e.Value)
+}
+
+// Is reports whether target is ErrPanic.
+func (e *PanicError) Is(target error) bool {
+	return target == ErrPanic
+}
+
+// Runner is a run loop a supervisor can own, such as a processor or a journaler.
+type Runner interface {
+	Run() error
+	Stop()
+}
+
+// RestartPolicy decides whether a supervisor restarts a run loop that failed.
+type RestartPolicy struct {
+	MaxRestarts int           // Restarts allowed within the window. Negative is unlimited.
+	Window      time.Duration // Period the restarts are counted over. Zero counts them all.
+}
+
+var (
+	// RestartNever escalates the first failure.
+	RestartNever = RestartPolicy{}
+
+	// RestartAlways restarts after every failure.
+	RestartAlways = RestartPolicy{MaxRestarts: -1}
+)
+
+// RestartLimit allows at most n restarts within window before the failure is escalated.
+func RestartLimit(n int, window time.Duration) RestartPolicy {
+	return RestartPolicy{MaxRestarts: n, Window: window}
+}
+
+// Restart describes a run loop the supervisor is about to restart.
+type Restart struct {
+	Name     string        // Name the run loop was added with.
+	Err      error         // Why it stopped.
+	Restarts int           // How many times it has been restarted, including this one.
+	Sequence int64         // Where it resumes from, if the run loop has a Sequence.
+	Delay    time.Duration // How long the supervisor waits before restarting it.
+}
+
+// supervised is a run loop owned by a supervisor.
+type supervised struct {
+	name     string
+	runner   Runner
+	policy   RestartPolicy
+	restarts []time.Time   // When it was restarted, within the policy window.
+	count    int           // How many times it has been restarted.
+	delay    time.Duration // The wait before its last restart.
+}
+
+// run calls Run, turning a panic into a PanicError.
+func (s *supervised) run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return s.runner.Run()
+}
+
+// allow counts a restart at now against the policy and reports whether it is within the limit.
+func (s *supervised) allow(now time.Time) bool {
+	if s.policy.MaxRestarts < 0 {
+		s.count++
+		return true
+	}
+	if s.policy.Window > 0 {
+		kept := s.restarts[:0]
+		for _, t := range s.restarts {
+			if now.Sub(t) < s.policy.Window {
+				kept = append(kept, t)
+			}
+		}
+		s.restarts = kept
+	}
+	if len(s.restarts) >= s.policy.MaxRestarts {
+		return false
+	}
+	s.restarts = append(s.restarts, now)
+	s.count++
+	return true
+}
+
+// backoff returns how long to wait before restarting a run loop that failed after running for ran.
+// The wait starts at initial and doubles with each consecutive failure up to max. A run that lasted
+// at least max is taken as healthy, so the wait after it starts again from initial.
+func (s *supervised) backoff(ran, initial, max time.Duration) time.Duration {
+	if s.delay == 0 || ran >= max {
+		s.delay = initial
+	} else {
+		s.delay *= 2
+	}
+	if s.delay > max {
+		s.delay = max
+	}
+	return s.delay
+}
+
+// supervisor owns the go routines of a set of run loops. A run loop that returns an error or panics
+// is restarted according to its policy and picks up from its last commit. Processors commit every
+// event before the one that failed, even when the handler panics, so they resume at the failed event.
+// Once a run loop has used up its restarts, the supervisor halts the whole topology by stopping every
+// run loop, in the manner of an errgroup, and Run returns the failure. A run loop that returns nil is
+// finished and is not restarted. Restarts are spaced out by a backoff, so a run loop that fails as
+// soon as it starts does not spin.
+type supervisor struct {
+	members    []*supervised // The run loops owned.
+	onRestart  func(Restart) // Called before each restart.
+	backoff    time.Duration // The wait before the first of consecutive restarts.
+	maxBackoff time.Duration // The cap on the wait as it doubles.
+	mu         sync.Mutex    // Guards the halt.
+	halted     chan struct{} // Closed when the supervisor halts.
+	err        error         // The failure that halted the supervisor.
+	running    bool          // Is this supervisor running its members in a Run() call?
+}
+
+// NewSupervisor is a factory function for returning a new instance of a supervisor.
+func NewSupervisor() *supervisor {
+	return &supervisor{
+		backoff:    time.Millisecond,
+		maxBackoff: time.Second,
+		halted:     make(chan struct{}),
+	}
+}
+
+// SetBackoff sets the wait before restarting a failed run loop. It starts at initial and doubles with
+// each consecutive failure up to max. The default is a millisecond doubling up to a second; zero for
+// both restarts at once. It must be called before Run.
+func (s *supervisor) SetBackoff(initial, max time.Duration) {
+	s.backoff = initial
+	s.maxBackoff = max
+}
+
+// Add hands a run loop to the supervisor under name with the policy used to restart it.
+// It must be called before Run.
+func (s *supervisor) Add(name string, r Runner, p RestartPolicy) {
+	s.members = append(s.members, &supervised{name: name, runner: r, policy: p})
+}
+
+// OnRestart sets a function called on the failed run loop's go routine before each restart.
+func (s *supervisor) OnRestart(fn func(Restart)) {
+	s.onRestart = fn
+}
+
+// Run starts every run loop on its own go routine and waits for them all to finish. It returns the
+// failure that halted the supervisor, or nil if they finished or were stopped.
+func (s *supervisor) Run() error {
+	s.running = true
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, m := range s.members {
+		wg.Add(1)
+		go func(m *supervised) {
+			defer wg.Done()
+			s.supervise(m)
+		}(m)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-s.halted:
+		// A run loop restarted as the halt began may miss the first Stop, so keep stopping them.
+		for stopped := false; !stopped; {
+			for _, m := range s.members {
+				m.runner.Stop()
+			}
+			select {
+			case <-done:
+				stopped = true
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+	s.running = false
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Stop halts the supervisor, stopping every run loop without an error.
+func (s *supervisor) Stop() {
+	s.halt(nil)
+}
+
+// Running returns the state of the running flag.
+func (s *supervisor) Running() bool {
+	return s.running
+}
+
+// halt records err, unless the supervisor has already halted, and signals Run to stop everything.
+func (s *supervisor) halt(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.halted:
+	default:
+		s.err = err
+		close(s.halted)
+	}
+}
+
+// isHalted reports whether the supervisor has halted.
+func (s *supervisor) isHalted() bool {
+	select {
+	case <-s.halted:
+		return true
+	default:
+		return false
+	}
+}
+
+// supervise runs m until it finishes, the supervisor halts or m's restarts are used up.
+func (s *supervisor) supervise(m *supervised) {
+	for !s.isHalted() {
+		start := time.Now()
+		err := m.run()
+		if err == nil || s.isHalted() {
+			return
+		}
+		if !m.allow(time.Now()) {
+			s.halt(fmt.Errorf("ringo: %s failed after %d restarts: %w", m.name, m.count, err))
+			return
+		}
+		delay := m.backoff(time.Since(start), s.backoff, s.maxBackoff)
+		if s.onRestart != nil {
+			r := Restart{Name: m.name, Err: err, Restarts: m.count, Delay: delay}
+			if seq, ok := m.runner.(sequencer); ok {
+				r.Sequence = seq.Sequence()
+			}
+			s.onRestart(r)
+		}
+		if delay > 0 {
+			select {
+			case <-s.halted:
+				return
+			case <-time.After(delay):
+			}
+		}
+	}
+}
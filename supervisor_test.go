@@ -0,0 +1,205 @@
+package ringo
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A consumer that panics part way through is restarted from its last commit:
+// 1 SimplePublishNode => 1 ConsumeProcessor (supervised)
+func TestSupervisorRestart(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	ring := make([]int64, 32)
+	var sum int64
+	failed := false
+
+	// Build the components
+	publisher := NewSimplePublishNode(32)
+	consumer := NewConsumeProcessor(NewSimpleConsumeNode(), HandlerFunc(func(seq int64, end bool) error {
+		if seq == 10 && !failed {
+			failed = true
+			panic("bad event")
+		}
+		atomic.AddInt64(&sum, ring[seq&31])
+		return nil
+	}))
+
+	// Link the committed counter dependencies together.
+	consumer.Node().SetDependency(publisher.Committed())
+	publisher.SetDependency(consumer.Node().Committed())
+
+	s := NewSupervisor()
+	s.Add("consumer", consumer, RestartAlways)
+	var restarts []Restart
+	s.OnRestart(func(r Restart) {
+		restarts = append(restarts, r)
+	})
+	result := make(chan error)
+	go func() {
+		result <- s.Run()
+	}()
+
+	for i := int64(0); i < 64; i++ {
+		ndx := *publisher.Reserve()
+		ring[ndx&31] = ndx
+		publisher.Commit()
+	}
+	for consumer.Sequence() < 64 {
+		runtime.Gosched()
+	}
+	s.Stop()
+	if err := <-result; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(restarts) != 1 {
+		t.Fatalf("Expected 1 restart, got %d", len(restarts))
+	}
+	if r := restarts[0]; r.Name != "consumer" || r.Sequence != 10 || r.Restarts != 1 ||
+		!errors.Is(r.Err, ErrPanic) {
+		t.Errorf("Unexpected restart: %+v", r)
+	}
+	if sum != 64*63/2 {
+		t.Errorf("Expected sum %d, got %d", 64*63/2, sum)
+	}
+	if s.Running() || consumer.Running() {
+		t.Error("Expected everything to be stopped")
+	}
+}
+
+// A consumer that keeps failing uses up its restarts and halts the other consumer with it.
+func TestSupervisorEscalate(t *testing.T) {
+	errBad := errors.New("bad event")
+
+	publisher := NewSimpleNode(true, 32)
+	healthy := NewNodeProcessor(NewSimpleNode(false, 32), HandlerFunc(func(int64, bool) error {
+		return nil
+	}))
+	failing := NewNodeProcessor(NewSimpleNode(false, 32), HandlerFunc(func(seq int64, end bool) error {
+		if seq == 5 {
+			return errBad
+		}
+		return nil
+	}))
+	healthy.Node().SetDependency(publisher.Committed())
+	failing.Node().SetDependency(publisher.Committed())
+	publisher.SetDependency(failing.Node().Committed())
+	for i := 0; i < 8; i++ {
+		publisher.Commit(publisher.Reserve())
+	}
+
+	s := NewSupervisor()
+	s.Add("healthy", healthy, RestartAlways)
+	s.Add("failing", failing, RestartLimit(3, time.Minute))
+	var restarts int
+	s.OnRestart(func(r Restart) {
+		restarts++
+	})
+	err := s.Run()
+	if !errors.Is(err, errBad) {
+		t.Fatalf("Expected the failure to be escalated, got %v", err)
+	}
+	if restarts != 3 {
+		t.Errorf("Expected 3 restarts, got %d", restarts)
+	}
+	if failing.Sequence() != 5 || healthy.Running() {
+		t.Errorf("Expected the failing consumer at 5 and both stopped, got %d", failing.Sequence())
+	}
+
+	// Without restarts, the first panic halts.
+	s = NewSupervisor()
+	s.Add("panicking", NewNodeProcessor(failing.Node(), HandlerFunc(func(int64, bool) error {
+		panic("bad event")
+	})), RestartNever)
+	if err := s.Run(); !errors.Is(err, ErrPanic) {
+		t.Errorf("Expected ErrPanic, got %v", err)
+	}
+}
+
+// Restarts older than the window no longer count against the limit.
+func TestRestartWindow(t *testing.T) {
+	m := &supervised{policy: RestartLimit(2, time.Second)}
+	now := time.Now()
+	if !m.allow(now) || !m.allow(now.Add(time.Millisecond)) {
+		t.Fatal("Expected two restarts to be allowed")
+	}
+	if m.allow(now.Add(2 * time.Millisecond)) {
+		t.Error("Expected a third restart within the window to be refused")
+	}
+	if !m.allow(now.Add(1500 * time.Millisecond)) {
+		t.Error("Expected a restart once the first ones left the window")
+	}
+	if m.count != 3 {
+		t.Errorf("Expected 3 restarts counted, got %d", m.count)
+	}
+}
+
+// failingRunner is a run loop that fails as soon as it starts.
+type failingRunner struct {
+	runs int64 // How many times Run was called.
+}
+
+func (f *failingRunner) Run() error {
+	atomic.AddInt64(&f.runs, 1)
+	return errors.New("failed to start")
+}
+
+func (f *failingRunner) Stop() {}
+
+// A run loop that fails as soon as it starts is restarted at a rate bounded by the backoff,
+// rather than in a tight loop.
+func TestSupervisorBackoff(t *testing.T) {
+	r := &failingRunner{}
+	s := NewSupervisor()
+	s.SetBackoff(time.Millisecond, 8*time.Millisecond)
+	s.Add("failing", r, RestartAlways)
+	var delays []time.Duration
+	s.OnRestart(func(r Restart) {
+		delays = append(delays, r.Delay)
+	})
+	result := make(chan error)
+	go func() {
+		result <- s.Run()
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	s.Stop()
+	if err := <-result; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// 1+2+4ms, then at most one restart every 8ms.
+	if runs := atomic.LoadInt64(&r.runs); runs < 4 || runs > 3+100/8+1 {
+		t.Errorf("Expected the backoff to bound the restarts in 100ms, got %d", runs)
+	}
+	for i, d := range delays {
+		want := time.Millisecond << uint(i)
+		if want > 8*time.Millisecond {
+			want = 8 * time.Millisecond
+		}
+		if d != want {
+			t.Errorf("Expected restart %d to wait %s, got %s", i+1, want, d)
+		}
+	}
+}
+
+// The backoff doubles with consecutive failures up to the cap, and starts again after a healthy run.
+func TestRestartBackoff(t *testing.T) {
+	m := &supervised{}
+	var got []time.Duration
+	for _, ran := range []time.Duration{0, 0, 0, 0, 0, time.Second, 0} {
+		got = append(got, m.backoff(ran, 10*time.Millisecond, 50*time.Millisecond))
+	}
+	want := []time.Duration{10, 20, 40, 50, 50, 10, 20}
+	for i := range want {
+		if got[i] != want[i]*time.Millisecond {
+			t.Errorf("Expected wait %d to be %dms, got %s", i, want[i], got[i])
+		}
+	}
+}
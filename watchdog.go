@@ -0,0 +1,143 @@
+package ringo
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// Stall describes a node that has had work available but made no progress for the threshold.
+type Stall struct {
+	Name      string        // The node that is stuck.
+	Sequence  int64         // The index the node is stuck at.
+	Waiting   string        // The dependency the node is waiting on.
+	Available int64         // The sequence of the dependency, which is past the node.
+	Duration  time.Duration // How long the node has gone without progress.
+	Stacks    []byte        // The stacks of every go routine, if DumpStacks is set.
+}
+
+// String describes the stall.
+func (s Stall) String() string {
+	return fmt.Sprintf("ringo: %s stuck at %d for %s with %s at %d", s.Name, s.Sequence, s.Duration,
+		s.Waiting, s.Available)
+}
+
+// watch is a node being watched by a watchdog.
+type watch struct {
+	name     string    // Name of the node.
+	node     sequencer // The node.
+	depName  string    // Name of the dependency.
+	dep      sequencer // The dependency.
+	last     int64     // Sequence of the node when it last moved.
+	moved    time.Time // When the node last moved, or last had nothing to do.
+	reported bool      // Has the current stall been reported?
+}
+
+// watchdog samples the progress of the nodes in a topology and reports any node that has work
+// available from its dependency but has not advanced within a threshold. This catches miswired
+// topologies and consumer go routines that have exited or wedged, which otherwise leave everything
+// spinning in Reserve. Each stall is reported once, and again only after the node has moved.
+type watchdog struct {
+	threshold  time.Duration // How long a node with work may go without progress.
+	watches    []*watch      // The nodes being watched.
+	onStall    func(Stall)   // Called for each stall found.
+	dumpStacks bool          // Include every go routine's stack in each stall.
+	running    bool          // Is this watchdog sampling in a Run() loop?
+}
+
+// NewWatchdog is a factory function for returning a new instance of a watchdog.
+func NewWatchdog(threshold time.Duration) *watchdog {
+	return &watchdog{
+		threshold: threshold,
+	}
+}
+
+// Watch adds a node to be watched, along with the upstream dependency it reads from. Consumers,
+// barriers and stages can all be watched. A publisher waits on nodes downstream of it, so watch
+// those instead. All nodes must be added before Run is called.
+func (w *watchdog) Watch(name string, node sequencer, depName string, dep sequencer) {
+	w.watches = append(w.watches, &watch{
+		name:    name,
+		node:    node,
+		depName: depName,
+		dep:     dep,
+		last:    node.Sequence(),
+		moved:   time.Now(),
+	})
+}
+
+// OnStall is a setter for the function called with each stall found.
+func (w *watchdog) OnStall(fn func(Stall)) {
+	w.onStall = fn
+}
+
+// DumpStacks sets whether the stacks of every go routine are included in each stall.
+func (w *watchdog) DumpStacks(dump bool) {
+	w.dumpStacks = dump
+}
+
+// Run samples the nodes four times per threshold until Stop is called.
+func (w *watchdog) Run() {
+	w.running = true
+	for w.running {
+		w.Check()
+		time.Sleep(w.threshold / 4)
+	}
+}
+
+// Stop breaks the loop cycle of the run.
+func (w *watchdog) Stop() {
+	w.running = false
+}
+
+// Running returns the state of the running flag.
+func (w *watchdog) Running() bool {
+	return w.running
+}
+
+// Check samples every node once, calls back for any new stall and returns them.
+func (w *watchdog) Check() []Stall {
+	var stalls []Stall
+	now := time.Now()
+	for _, watch := range w.watches {
+		seq, available := watch.node.Sequence(), watch.dep.Sequence()
+		if seq != watch.last || available <= seq {
+			// Moving, or idle with nothing to do.
+			watch.last = seq
+			watch.moved = now
+			watch.reported = false
+			continue
+		}
+		if watch.reported || now.Sub(watch.moved) < w.threshold {
+			continue
+		}
+		watch.reported = true
+		stall := Stall{
+			Name:      watch.name,
+			Sequence:  seq,
+			Waiting:   watch.depName,
+			Available: available,
+			Duration:  now.Sub(watch.moved),
+		}
+		if w.dumpStacks {
+			stall.Stacks = stacks()
+		}
+		stalls = append(stalls, stall)
+		if w.onStall != nil {
+			w.onStall(stall)
+		}
+	}
+	return stalls
+}
+
+// stacks returns the stacks of every go routine.
+func stacks() []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
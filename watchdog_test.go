@@ -0,0 +1,89 @@
+package ringo
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// A pipeline whose first consumer dies part way through:
+// 1 SimplePublishNode => 1 SimpleConsumeNode => 1 SimpleConsumeNode
+func TestWatchdog(t *testing.T) {
+	// Build the components
+	publisher := NewSimplePublishNode(32)
+	consumer1 := NewSimpleConsumeNode()
+	consumer2 := NewSimpleConsumeNode()
+
+	// Link the committed counter dependencies together.
+	consumer1.SetDependency(publisher.Committed())
+	consumer2.SetDependency(consumer1.Committed())
+	publisher.SetDependency(consumer2.Committed())
+
+	w := NewWatchdog(20 * time.Millisecond)
+	w.Watch("consumer1", consumer1, "publisher", publisher)
+	w.Watch("consumer2", consumer2, "consumer1", consumer1)
+
+	// Both consumers read 10 events and then exit, leaving 10 unread.
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 10; i++ {
+			consumer1.Reserve()
+			consumer1.Commit()
+		}
+		done <- true
+	}()
+	go func() {
+		for i := 0; i < 10; i++ {
+			consumer2.Reserve()
+			consumer2.Commit()
+		}
+		done <- true
+	}()
+	for i := 0; i < 20; i++ {
+		publisher.Reserve()
+		publisher.Commit()
+	}
+	<-done
+	<-done
+
+	if stalls := w.Check(); len(stalls) != 0 {
+		t.Fatalf("Expected no stalls before the threshold, got %v", stalls)
+	}
+	time.Sleep(25 * time.Millisecond)
+	stalls := w.Check()
+	if len(stalls) != 1 {
+		t.Fatalf("Expected 1 stall, got %v", stalls)
+	}
+	if s := stalls[0]; s.Name != "consumer1" || s.Sequence != 10 || s.Waiting != "publisher" || s.Available != 20 {
+		t.Errorf("Unexpected stall %s", s)
+	}
+	if stalls := w.Check(); len(stalls) != 0 {
+		t.Errorf("Expected the stall to be reported once, got %v", stalls)
+	}
+
+	// Progress clears the stall, and stalling again is reported again through the callback.
+	consumer1.Reserve()
+	consumer1.Commit()
+	w.Check()
+	reported := make(chan Stall, 1)
+	w.OnStall(func(s Stall) {
+		select {
+		case reported <- s:
+		default:
+		}
+	})
+	w.DumpStacks(true)
+	go w.Run()
+	defer w.Stop()
+	select {
+	case s := <-reported:
+		if s.Name != "consumer1" || s.Sequence != 11 {
+			t.Errorf("Unexpected stall %s", s)
+		}
+		if !bytes.Contains(s.Stacks, []byte("goroutine")) {
+			t.Error("Expected the stacks to be dumped")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the stall to be reported")
+	}
+}
@@ -0,0 +1,92 @@
+package ringo
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+)
+
+// watermarkMonitor watches how full a ring is and calls back when the occupancy crosses a high or
+// low watermark. Occupancy is measured by the publisher against its own slowest dependency, the same
+// gate it checks in Reserve, so every consumer it is gated on counts. Once the high watermark has
+// fired, the low watermark must be crossed before it can fire again. This lets a publisher pause its
+// source, for example a socket reader, before the ring fills and resume it once it has drained.
+type watermarkMonitor struct {
+	publisher occupant              // The publisher being watched.
+	high      int64                 // Occupancy at or above which onHigh is called.
+	low       int64                 // Occupancy at or below which onLow is called.
+	onHigh    func(occupancy int64) // Called when the high watermark is crossed.
+	onLow     func(occupancy int64) // Called when the low watermark is crossed after a high.
+	above     int32                 // Set to 1 while between a high and a low crossing.
+	running   bool                  // Is this monitor checking the occupancy in a Run() loop?
+}
+
+// occupant is implemented by every publisher, and by Type 2 leaders. Occupancy returns how many
+// events have been published that the slowest dependency has not finished.
+type occupant interface {
+	Occupancy() int64
+}
+
+// NewWatermarkMonitor is a factory function for returning a new instance of a watermarkMonitor that
+// watches publisher p on a ring of size. high and low are fractions of size, such as 0.8 and 0.2,
+// with 0 <= low < high <= 1.
+func NewWatermarkMonitor(p occupant, size int64, high float64, low float64) (*watermarkMonitor, error) {
+	if low < 0 || low >= high || high > 1 {
+		return nil, errors.New("ringo: watermarks must satisfy 0 <= low < high <= 1")
+	}
+	return &watermarkMonitor{
+		publisher: p,
+		high:      int64(high * float64(size)),
+		low:       int64(low * float64(size)),
+	}, nil
+}
+
+// Run continually checks the occupancy of the ring.
+func (w *watermarkMonitor) Run() {
+	w.running = true
+	for w.running {
+		w.Check()
+		runtime.Gosched()
+	}
+}
+
+// Stop breaks the loop cycle of the run.
+func (w *watermarkMonitor) Stop() {
+	w.running = false
+}
+
+// Running returns the state of the running flag.
+func (w *watermarkMonitor) Running() bool {
+	return w.running
+}
+
+// Check measures the occupancy once, fires any callback that is due and returns the occupancy.
+// A publisher may call this after Commit in addition to, or instead of, a Run() loop.
+func (w *watermarkMonitor) Check() int64 {
+	occupancy := w.publisher.Occupancy()
+	if occupancy >= w.high {
+		if atomic.CompareAndSwapInt32(&w.above, 0, 1) && w.onHigh != nil {
+			w.onHigh(occupancy)
+		}
+	} else if occupancy <= w.low {
+		if atomic.CompareAndSwapInt32(&w.above, 1, 0) && w.onLow != nil {
+			w.onLow(occupancy)
+		}
+	}
+	return occupancy
+}
+
+// Above returns true if the high watermark has been crossed and the low watermark has not since.
+func (w *watermarkMonitor) Above() bool {
+	return atomic.LoadInt32(&w.above) == 1
+}
+
+// OnHigh is a setter for the function called when the high watermark is crossed.
+func (w *watermarkMonitor) OnHigh(fn func(occupancy int64)) {
+	w.onHigh = fn
+}
+
+// OnLow is a setter for the function called when the low watermark is crossed after a high.
+func (w *watermarkMonitor) OnLow(fn func(occupancy int64)) {
+	w.onLow = fn
+}
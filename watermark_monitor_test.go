@@ -0,0 +1,164 @@
+package ringo
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWatermarkHysteresis(t *testing.T) {
+	var consumed int64
+	var highs, lows []int64
+
+	publisher := NewSimplePublishNode(100)
+	publisher.SetDependency(&consumed)
+	monitor, err := NewWatermarkMonitor(publisher, 100, 0.8, 0.2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	monitor.OnHigh(func(occupancy int64) { highs = append(highs, occupancy) })
+	monitor.OnLow(func(occupancy int64) { lows = append(lows, occupancy) })
+
+	steps := []struct {
+		published, consumed int64
+	}{
+		{50, 0},    // Below high.
+		{80, 0},    // High fires.
+		{90, 0},    // Still above, no repeat.
+		{90, 50},   // Between the watermarks, nothing.
+		{100, 10},  // Above again but low has not been crossed.
+		{100, 80},  // Low fires.
+		{100, 90},  // Still below, no repeat.
+		{190, 100}, // High fires again.
+	}
+	for _, s := range steps {
+		publisher.committed, consumed = s.published, s.consumed
+		monitor.Check()
+	}
+
+	if len(highs) != 2 || highs[0] != 80 || highs[1] != 90 {
+		t.Errorf("Expected high callbacks at 80 and 90, got %v.", highs)
+	}
+	if len(lows) != 1 || lows[0] != 20 {
+		t.Errorf("Expected a low callback at 20, got %v.", lows)
+	}
+	if !monitor.Above() {
+		t.Errorf("Expected the monitor to be above the high watermark.")
+	}
+}
+
+// A simple queue where the source pauses at the high watermark: Publisher <==> Consumer
+func TestWatermarkPauseResume(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(-1)
+	runtime.GOMAXPROCS(runtime.NumCPU())
+	defer runtime.GOMAXPROCS(prevProcs)
+
+	master := NewSimplePublishNode(32)
+	slave := NewSimpleConsumeNode()
+	master.SetDependency(slave.Committed())
+	slave.SetDependency(master.Committed())
+
+	var paused int32
+	var pauses, resumes int64
+	monitor, err := NewWatermarkMonitor(master, 32, 0.75, 0.25)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	monitor.OnHigh(func(int64) { atomic.StoreInt32(&paused, 1); atomic.AddInt64(&pauses, 1) })
+	monitor.OnLow(func(int64) { atomic.StoreInt32(&paused, 0); atomic.AddInt64(&resumes, 1) })
+
+	done := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		monitor.Run()
+		close(stopped)
+	}()
+
+	go func() {
+		for i := int64(0); i < 1024; i++ {
+			slave.Reserve()
+			slave.Commit()
+		}
+		close(done)
+	}()
+
+	for i := int64(0); i < 1024; i++ {
+		for atomic.LoadInt32(&paused) == 1 {
+			runtime.Gosched()
+		}
+		master.Reserve()
+		master.Commit()
+	}
+	<-done
+	monitor.Stop()
+	<-stopped
+
+	pauses, resumes = atomic.LoadInt64(&pauses), atomic.LoadInt64(&resumes)
+	if pauses < resumes || pauses > resumes+1 {
+		t.Errorf("Expected callbacks to alternate, got %d pauses and %d resumes.", pauses, resumes)
+	}
+}
+
+// Occupancy is measured against the slowest of the consumers a publisher is gated on, for both types.
+func TestWatermarkOccupancy(t *testing.T) {
+	// Type 1: 1 SimplePublishNode => 2 SimpleConsumeNode
+	publisher1 := NewSimplePublishNode(32)
+	fast, slow := NewSimpleConsumeNode(), NewSimpleConsumeNode()
+	fast.SetDependency(publisher1.Committed())
+	slow.SetDependency(publisher1.Committed())
+	publisher1.AddDependency(fast.Committed())
+	publisher1.AddDependency(slow.Committed())
+
+	// Type 2: 1 SimpleNode => 1 SimpleNode
+	publisher2 := NewSimpleNode(true, 32)
+	consumer := NewSimpleNode(false, 32)
+	consumer.SetDependency(publisher2.Committed())
+	publisher2.SetDependency(consumer.Committed())
+
+	for i := 0; i < 20; i++ {
+		publisher1.Reserve()
+		publisher1.Commit()
+		publisher2.Commit(publisher2.Reserve())
+	}
+	for i := 0; i < 15; i++ {
+		fast.Reserve()
+		fast.Commit()
+		if i < 5 {
+			slow.Reserve()
+			slow.Commit()
+		}
+		consumer.Commit(consumer.Reserve())
+	}
+
+	for _, test := range []struct {
+		name      string
+		publisher occupant
+		expected  int64
+	}{
+		{"Type 1", publisher1, 15},
+		{"Type 2", publisher2, 5},
+	} {
+		monitor, err := NewWatermarkMonitor(test.publisher, 32, 0.4, 0.1)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.name, err)
+		}
+		if got := monitor.Check(); got != test.expected {
+			t.Errorf("%s: expected occupancy %d, got %d", test.name, test.expected, got)
+		}
+		if monitor.Above() != (test.expected >= 12) {
+			t.Errorf("%s: unexpected high watermark state at %d", test.name, test.expected)
+		}
+	}
+}
+
+func TestWatermarkValidation(t *testing.T) {
+	publisher := NewSimplePublishNode(32)
+	for _, w := range [][2]float64{{0.5, 0.5}, {0.2, 0.8}, {1.5, 0.2}, {0.8, -0.1}} {
+		if _, err := NewWatermarkMonitor(publisher, 32, w[0], w[1]); err == nil {
+			t.Errorf("Expected high %v and low %v to be rejected", w[0], w[1])
+		}
+	}
+	if _, err := NewWatermarkMonitor(publisher, 32, 1, 0); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}